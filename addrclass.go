@@ -0,0 +1,52 @@
+package main
+
+import "net/netip"
+
+// reservedPrefixes 为 IANA 特殊用途地址段中 netip 未单独提供判断方法的部分
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001::/23"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("2002::/16"),
+}
+
+type addrClass struct {
+	private  bool
+	loopback bool
+	global   bool
+	reserved bool
+}
+
+func classifyAddr(ip netip.Addr) addrClass {
+	ip = ip.Unmap()
+	class := addrClass{
+		private:  ip.IsPrivate(),
+		loopback: ip.IsLoopback(),
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(ip) {
+			class.reserved = true
+			break
+		}
+	}
+	// 公网可路由：全局单播且不属于私有、保留地址段
+	class.global = ip.IsGlobalUnicast() && !class.private && !class.reserved
+	return class
+}
+
+// ipVersion 返回地址族，IPv4 映射的 IPv6 地址（::ffff:a.b.c.d）按 4 计
+func ipVersion(ip netip.Addr) uint8 {
+	if ip.Unmap().Is4() {
+		return 4
+	}
+	return 6
+}
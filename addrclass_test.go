@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestClassifyAddr(t *testing.T) {
+	testCases := []struct {
+		ip   string
+		want addrClass
+	}{
+		{"8.8.8.8", addrClass{global: true}},
+		{"10.1.2.3", addrClass{private: true}},
+		{"127.0.0.1", addrClass{loopback: true}},
+		{"100.64.0.1", addrClass{reserved: true}},
+		{"203.0.113.5", addrClass{reserved: true}},
+		{"::ffff:192.168.1.1", addrClass{private: true}},
+		{"2001:4860:4860::8888", addrClass{global: true}},
+		{"2001:db8::1", addrClass{reserved: true}},
+		{"::1", addrClass{loopback: true}},
+	}
+	for _, tc := range testCases {
+		if got := classifyAddr(netip.MustParseAddr(tc.ip)); got != tc.want {
+			t.Errorf("classifyAddr(%s) = %+v, want %+v", tc.ip, got, tc.want)
+		}
+	}
+}
+
+func TestIPVersion(t *testing.T) {
+	for addr, want := range map[string]uint8{
+		"8.8.8.8":         4,
+		"::ffff:8.8.8.8":  4,
+		"2001:4860::8888": 6,
+		"::1":             6,
+	} {
+		if got := ipVersion(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("ipVersion(%s) = %d, want %d", addr, got, want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// anycastList 为 -anycast-list 加载的已知 anycast ASN 与网段，随 SIGHUP 热加载
+type anycastList struct {
+	asns     map[uint]struct{}
+	prefixes []netip.Prefix
+}
+
+var anycastNetworks atomic.Pointer[anycastList]
+
+// loadAnycastList 读取每行一个 ASN（可带 AS 前缀）或 CIDR/IP 的文件，# 之后为注释
+func loadAnycastList(path string) (*anycastList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	list := &anycastList{asns: make(map[uint]struct{})}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		if text = strings.TrimSpace(text); text == "" {
+			continue
+		}
+		if strings.ContainsAny(text, ".:") {
+			prefix, err := netip.ParsePrefix(text)
+			if err != nil {
+				addr, addrErr := netip.ParseAddr(text)
+				if addrErr != nil {
+					return nil, fmt.Errorf("line %d: invalid network %q", line, text)
+				}
+				prefix = netip.PrefixFrom(addr, addr.BitLen())
+			}
+			list.prefixes = append(list.prefixes, prefix.Masked())
+			continue
+		}
+		asn, err := parseASN(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid ASN %q", line, text)
+		}
+		list.asns[asn] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func reloadAnycastList(path string) (int, error) {
+	list, err := loadAnycastList(path)
+	if err != nil {
+		return 0, err
+	}
+	anycastNetworks.Store(list)
+	return len(list.asns) + len(list.prefixes), nil
+}
+
+// isAnycastListed 判断 IP 所在网段或其 ASN 是否在 -anycast-list 中。
+// 按 ASN 判断较粗糙：同一 ASN 下也可能有单播网段，需要精确时应列出网段
+func isAnycastListed(ip netip.Addr, asn uint) bool {
+	list := anycastNetworks.Load()
+	if list == nil {
+		return false
+	}
+	if asn != 0 {
+		if _, ok := list.asns[asn]; ok {
+			return true
+		}
+	}
+	ip = ip.Unmap()
+	for _, prefix := range list.prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
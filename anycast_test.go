@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/oschwald/geoip2-golang/v2"
+)
+
+func TestAnycastList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "anycast.txt")
+	content := "# known anycast\nAS13335\n8.8.8.0/24 # Google DNS\n2620:fe::fe\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := reloadAnycastList(path)
+	if err != nil || n != 3 {
+		t.Fatalf("reloadAnycastList = %d, %v", n, err)
+	}
+	defer anycastNetworks.Store(nil)
+
+	for _, tc := range []struct {
+		ip   string
+		asn  uint
+		want bool
+	}{
+		{"1.1.1.1", 13335, true},
+		{"8.8.8.8", 15169, true},
+		{"::ffff:8.8.8.8", 0, true},
+		{"2620:fe::fe", 0, true},
+		{"8.8.4.4", 15169, false},
+		{"203.0.113.1", 0, false},
+	} {
+		if got := isAnycastListed(netip.MustParseAddr(tc.ip), tc.asn); got != tc.want {
+			t.Errorf("isAnycastListed(%s, %d) = %v, want %v", tc.ip, tc.asn, got, tc.want)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("13335\n8.8.8.0/33\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reloadAnycastList(path); err == nil {
+		t.Error("expected error for invalid network")
+	}
+	if !isAnycastListed(netip.MustParseAddr("1.1.1.1"), 13335) {
+		t.Error("previous list should be kept after a failed reload")
+	}
+}
+
+func TestNewGeoResponseAnycastFromDatabase(t *testing.T) {
+	city := &geoip2.City{}
+	city.Traits.IsAnycast = true
+	if res := newGeoResponse(netip.MustParseAddr("1.1.1.1"), &geoCacheEntry{country: city}); !res.IsAnycast {
+		t.Error("is_anycast from database traits not set")
+	}
+}
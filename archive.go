@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/groupcache/lru"
+	"github.com/oschwald/geoip2-golang/v2"
+)
+
+// archiveDatePattern 匹配文件名中的 YYYY-MM-DD 或 YYYYMMDD 日期，如 GeoLite2-City_20230101.mmdb
+var archiveDatePattern = regexp.MustCompile(`(\d{4})-?(\d{2})-?(\d{2})`)
+
+// archives 为 -archive-dir 指定的历史库目录，为 nil 时不支持 ?date=
+var archives *dbArchive
+
+type archiveFile struct {
+	date time.Time
+	path string
+}
+
+// dbArchive 记录目录中按日期命名的城市库与 ASN 库，按需打开并以 LRU 保留最近使用的 reader
+type dbArchive struct {
+	dir string
+	// mu 保护以下字段；查询全程持锁，保证不会关闭正在使用的 reader
+	mu   sync.Mutex
+	city []archiveFile // 按日期升序
+	asn  []archiveFile
+	open *lru.Cache // 路径 → *geoip2.Reader
+}
+
+func newDBArchive(dir string, maxReaders int) (*dbArchive, error) {
+	a := &dbArchive{dir: dir, open: lru.New(maxReaders)}
+	a.open.OnEvicted = func(_ lru.Key, v any) {
+		v.(*geoip2.Reader).Close()
+	}
+	if _, err := a.rescan(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// scanArchive 列出 dir 中文件名带日期的 .mmdb / .mmdb.gz，文件名含 ASN 的归为 ASN 库，其余为城市库
+func scanArchive(dir string) (city, asn []archiveFile, err error) {
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, ent := range ents {
+		name := ent.Name()
+		if ent.IsDir() || !(strings.HasSuffix(name, ".mmdb") || strings.HasSuffix(name, ".mmdb.gz")) {
+			continue
+		}
+		m := archiveDatePattern.FindStringSubmatch(name)
+		if m == nil {
+			continue
+		}
+		date, err := time.Parse("20060102", m[1]+m[2]+m[3])
+		if err != nil {
+			continue
+		}
+		f := archiveFile{date: date, path: filepath.Join(dir, name)}
+		if strings.Contains(strings.ToUpper(name), "ASN") {
+			asn = append(asn, f)
+		} else {
+			city = append(city, f)
+		}
+	}
+	byDate := func(a, b archiveFile) int { return a.date.Compare(b.date) }
+	slices.SortStableFunc(city, byDate)
+	slices.SortStableFunc(asn, byDate)
+	return city, asn, nil
+}
+
+// rescan 重新列出目录，已打开的 reader 全部关闭，避免继续使用被替换的文件
+func (a *dbArchive) rescan() (int, error) {
+	city, asn, err := scanArchive(a.dir)
+	if err != nil {
+		return 0, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.city, a.asn = city, asn
+	a.open.Clear()
+	return len(city) + len(asn), nil
+}
+
+// pickArchive 返回日期不晚于 date 的最新一个文件
+func pickArchive(files []archiveFile, date time.Time) (archiveFile, bool) {
+	i, _ := slices.BinarySearchFunc(files, date, func(f archiveFile, d time.Time) int {
+		if f.date.After(d) {
+			return 1
+		}
+		return -1
+	})
+	if i == 0 {
+		return archiveFile{}, false
+	}
+	return files[i-1], true
+}
+
+// reader 返回已打开的 reader，没有时打开并放入 LRU，调用方需持有 mu
+func (a *dbArchive) reader(path string) (*geoip2.Reader, error) {
+	if r, ok := a.open.Get(path); ok {
+		return r.(*geoip2.Reader), nil
+	}
+	r, err := openMMDB(path)
+	if err != nil {
+		return nil, err
+	}
+	a.open.Add(path, r)
+	return r, nil
+}
+
+// apply 用 date 当天适用的历史库替换 entry 中的城市与 ASN 数据，返回新的记录；
+// 某类库没有匹配的归档时保留当前库的结果，两类都没有时原样返回 entry
+func (a *dbArchive) apply(ip netip.Addr, date time.Time, entry *geoCacheEntry) (*geoCacheEntry, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	res := *entry
+	matched := false
+	if f, ok := pickArchive(a.city, date); ok {
+		r, err := a.reader(f.path)
+		if err != nil {
+			return nil, fmt.Errorf("open archive %s: %w", f.path, err)
+		}
+		if res.country, err = r.City(ip); err != nil {
+			return nil, err
+		}
+		res.confidence, res.countrySource = nil, newDataSource(f.path, r)
+		matched = true
+	}
+	if f, ok := pickArchive(a.asn, date); ok && !entry.asnSkipped {
+		r, err := a.reader(f.path)
+		if err != nil {
+			return nil, fmt.Errorf("open archive %s: %w", f.path, err)
+		}
+		if res.asn, err = r.ASN(ip); err != nil {
+			return nil, err
+		}
+		res.asnReg, res.asnSource = lookupASNRegistration(res.asn), newDataSource(f.path, r)
+		matched = true
+	}
+	if !matched {
+		return entry, nil
+	}
+
+	res.network = narrowNetwork(netip.Prefix{}, res.country.Traits.Network)
+	if res.asn != nil {
+		res.network = narrowNetwork(res.network, res.asn.Network)
+	}
+	return &res, nil
+}
+
+func reloadArchives() {
+	if archives == nil {
+		return
+	}
+	n, err := archives.rescan()
+	if err != nil {
+		log.Printf("Failed to rescan archive dir, keeping previous: %v", err)
+		return
+	}
+	log.Printf("Found %d archived databases in %s", n, archives.dir)
+}
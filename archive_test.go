@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestScanArchive(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"GeoLite2-City_20230101.mmdb",
+		"GeoLite2-City-2022-06-15.mmdb.gz",
+		"GeoLite2-ASN_20230101.mmdb",
+		"GeoLite2-City.mmdb", // 没有日期
+		"notes-20230101.txt",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	city, asn, err := scanArchive(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(city) != 2 || len(asn) != 1 {
+		t.Fatalf("got %d city and %d ASN archives, want 2 and 1", len(city), len(asn))
+	}
+	if filepath.Base(city[0].path) != "GeoLite2-City-2022-06-15.mmdb.gz" {
+		t.Errorf("archives not sorted by date: %v", city)
+	}
+
+	for _, tc := range []struct {
+		date string
+		want string
+	}{
+		{"2022-01-01", ""},
+		{"2022-06-15", "GeoLite2-City-2022-06-15.mmdb.gz"},
+		{"2022-12-31", "GeoLite2-City-2022-06-15.mmdb.gz"},
+		{"2024-05-01", "GeoLite2-City_20230101.mmdb"},
+	} {
+		date, _ := time.Parse(time.DateOnly, tc.date)
+		f, ok := pickArchive(city, date)
+		if got := filepath.Base(f.path); ok != (tc.want != "") || (ok && got != tc.want) {
+			t.Errorf("pickArchive(%s) = %q, %v, want %q", tc.date, got, ok, tc.want)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/oschwald/geoip2-golang/v2"
+)
+
+type asnInfo struct {
+	Organization string
+	Prefixes     []netip.Prefix
+}
+
+var (
+	// asnIndex 由 -asn-index 启动时遍历 ASN 库构建，只读
+	asnIndex map[uint]*asnInfo
+	// observedASNOrgs 记录正常查询过程中见到的 ASN → 组织名映射
+	observedASNOrgs   = make(map[uint]string)
+	observedASNsMutex sync.RWMutex
+)
+
+type ASNResponse struct {
+	ASN          uint           `json:"asn"`
+	Organization string         `json:"organization,omitempty"`
+	PrefixCount  int            `json:"prefix_count,omitempty"`
+	Prefixes     []netip.Prefix `json:"prefixes,omitempty"`
+	Source       string         `json:"source"`
+	RequestID    string         `json:"request_id,omitempty"`
+}
+
+func recordASNOrg(asn uint, org string) {
+	if asn == 0 || org == "" {
+		return
+	}
+	observedASNsMutex.RLock()
+	known := observedASNOrgs[asn] == org
+	observedASNsMutex.RUnlock()
+	if known {
+		return
+	}
+	observedASNsMutex.Lock()
+	observedASNOrgs[asn] = org
+	observedASNsMutex.Unlock()
+}
+
+// buildASNIndex 遍历整个 ASN 库，建立 ASN → 组织名/网段列表的反向索引
+func buildASNIndex(path string) (map[uint]*asnInfo, error) {
+	reader, err := openRawMMDB(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	start := time.Now()
+	index := make(map[uint]*asnInfo)
+	for result := range reader.Networks() {
+		var record struct {
+			Number       uint   `maxminddb:"autonomous_system_number"`
+			Organization string `maxminddb:"autonomous_system_organization"`
+		}
+		if err := result.Decode(&record); err != nil {
+			return nil, err
+		}
+		if record.Number == 0 {
+			continue
+		}
+		info, ok := index[record.Number]
+		if !ok {
+			info = &asnInfo{Organization: record.Organization}
+			index[record.Number] = info
+		}
+		info.Prefixes = append(info.Prefixes, result.Prefix())
+	}
+	log.Printf("Built ASN index: %d ASNs in %s", len(index), time.Since(start))
+	return index, nil
+}
+
+func parseASN(s string) (uint, error) {
+	s = strings.TrimSpace(s)
+	if len(s) > 2 && strings.EqualFold(s[:2], "AS") {
+		s = s[2:]
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || n == 0 {
+		return 0, strconv.ErrSyntax
+	}
+	return uint(n), nil
+}
+
+func asnHandler(c *gin.Context) {
+	asn, err := parseASN(c.Param("asn"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, ErrCodeInvalidASN, "Invalid ASN")
+		return
+	}
+
+	requestID, _ := c.Get("RequestID")
+	res := ASNResponse{ASN: asn, RequestID: requestID.(string)}
+
+	if info, ok := asnIndex[asn]; ok {
+		res.Organization = info.Organization
+		res.PrefixCount = len(info.Prefixes)
+		res.Prefixes = info.Prefixes
+		res.Source = "index"
+		c.JSON(http.StatusOK, res)
+		return
+	}
+
+	observedASNsMutex.RLock()
+	org, ok := observedASNOrgs[asn]
+	observedASNsMutex.RUnlock()
+	if !ok {
+		// 没有索引也没有 ASN 库时无从得知任何 ASN，与“库中没有该 ASN”区分开
+		dbMutex.RLock()
+		loaded := asnIndex != nil || asnDB != nil || len(asnFallbacks) > 0
+		dbMutex.RUnlock()
+		if !loaded {
+			abortWithError(c, http.StatusServiceUnavailable, ErrCodeNoData, "Database not loaded")
+			return
+		}
+		abortWithError(c, http.StatusNotFound, ErrCodeNoData, "ASN not found")
+		return
+	}
+	res.Organization = org
+	res.Source = "observed"
+	c.JSON(http.StatusOK, res)
+}
+
+type asnRegistration struct {
+	RIR     string
+	Country string
+}
+
+// asnRegistry 来自 -asn-country 指定的补充数据：ASN → RIR/注册国家
+var asnRegistry map[uint]asnRegistration
+
+// loadASNRegistry 读取 CSV 格式的补充文件：asn,rir,country，# 开头为注释；同一 ASN 出现多次视为错误
+func loadASNRegistry(path string) (map[uint]asnRegistration, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = 3
+	r.TrimLeadingSpace = true
+
+	registry := make(map[uint]asnRegistration)
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		asn, err := parseASN(rec[0])
+		if err != nil {
+			line, _ := r.FieldPos(0)
+			return nil, fmt.Errorf("line %d: invalid ASN %q", line, rec[0])
+		}
+		if _, ok := registry[asn]; ok {
+			line, _ := r.FieldPos(0)
+			return nil, fmt.Errorf("line %d: duplicate ASN %d", line, asn)
+		}
+		registry[asn] = asnRegistration{
+			RIR:     strings.ToUpper(strings.TrimSpace(rec[1])),
+			Country: strings.ToUpper(strings.TrimSpace(rec[2])),
+		}
+	}
+	return registry, nil
+}
+
+func lookupASNRegistration(asn *geoip2.ASN) *asnRegistration {
+	if asn == nil {
+		return nil
+	}
+	if reg, ok := asnRegistry[asn.AutonomousSystemNumber]; ok {
+		return &reg
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseASN(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  uint
+		ok    bool
+	}{
+		{"AS13335", 13335, true},
+		{"as13335", 13335, true},
+		{"13335", 13335, true},
+		{" AS13335 ", 13335, true},
+		{"4294967295", 4294967295, true},
+		{"0", 0, false},
+		{"AS0", 0, false},
+		{"4294967296", 0, false}, // 超出 32 位
+		{"AS", 0, false},
+		{"AS-1", 0, false},
+		{"cloudflare", 0, false},
+		{"", 0, false},
+	}
+	for _, tc := range testCases {
+		got, err := parseASN(tc.input)
+		if (err == nil) != tc.ok || got != tc.want {
+			t.Errorf("parseASN(%q) = %d, %v; want %d, ok=%v", tc.input, got, err, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestASNHandler(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(requestIDMiddleware())
+	r.GET("/api/asn/:asn", asnHandler)
+
+	get := func(path string) (int, ErrorResponse) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		r.ServeHTTP(w, req)
+		var res ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &res)
+		return w.Code, res
+	}
+
+	if code, res := get("/api/asn/bogus"); code != http.StatusBadRequest || res.Code != ErrCodeInvalidASN {
+		t.Errorf("bogus: status = %d, code = %s", code, res.Code)
+	}
+	// 没有索引、也没有加载 ASN 库时无法判断 ASN 是否存在
+	if code, res := get("/api/asn/AS13335"); code != http.StatusServiceUnavailable || res.Code != ErrCodeNoData {
+		t.Errorf("without database: status = %d, code = %s", code, res.Code)
+	}
+
+	asnIndex = map[uint]*asnInfo{15169: {Organization: "GOOGLE"}}
+	defer func() { asnIndex = nil }()
+	if code, res := get("/api/asn/AS13335"); code != http.StatusNotFound || res.Code != ErrCodeNoData {
+		t.Errorf("unknown ASN: status = %d, code = %s", code, res.Code)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/asn/as15169", nil)
+	r.ServeHTTP(w, req)
+	var res ASNResponse
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if w.Code != http.StatusOK || res.ASN != 15169 || res.Organization != "GOOGLE" || res.Source != "index" {
+		t.Errorf("indexed ASN: status = %d, body = %s", w.Code, w.Body.String())
+	}
+}
+
+func TestLoadASNRegistry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "asn-country.csv")
+	content := "# asn,rir,country\n15169,ARIN,US\nAS13335, arin , us\n\n3320,RIPE,DE\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	registry, err := loadASNRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[uint]asnRegistration{
+		15169: {RIR: "ARIN", Country: "US"},
+		13335: {RIR: "ARIN", Country: "US"},
+		3320:  {RIR: "RIPE", Country: "DE"},
+	}
+	if !reflect.DeepEqual(registry, want) {
+		t.Errorf("registry = %v, want %v", registry, want)
+	}
+
+	for name, content := range map[string]string{
+		"MissingColumn": "15169,ARIN,US\n13335,ARIN\n",
+		"ExtraColumn":   "15169,ARIN,US,extra\n",
+		"InvalidASN":    "15169,ARIN,US\nGOOGLE,ARIN,US\n",
+		"ZeroASN":       "0,ARIN,US\n",
+		"Duplicate":     "15169,ARIN,US\nAS15169,RIPE,NL\n",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadASNRegistry(path); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	// 错误信息指出重复出现的行
+	if err := os.WriteFile(path, []byte("15169,ARIN,US\nAS15169,RIPE,NL\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadASNRegistry(path); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("duplicate ASN error = %v, want line 2", err)
+	}
+}
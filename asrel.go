@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// maxASNRelations 限制响应中每类关系返回的 ASN 数量，大型网络的对等 ASN 可达数千个
+const maxASNRelations = 50
+
+type asnRelations struct {
+	upstreams []uint // 上游（provider）ASN
+	peers     []uint // 对等（peer）ASN
+}
+
+// asnRelationships 来自 -as-relationships 指定的 CAIDA AS Relationships 数据：ASN → 上游/对等 ASN
+var asnRelationships map[uint]*asnRelations
+
+// loadASRelationships 读取 CAIDA serial-1/serial-2 格式：<as1>|<as2>|<rel>[|source]，
+// rel 为 -1 表示 as1 是 as2 的上游，0 表示互为对等；# 开头为注释，.bz2 后缀的文件自动解压
+func loadASRelationships(path string) (map[uint]*asnRelations, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".bz2") {
+		r = bzip2.NewReader(f)
+	}
+
+	rels := make(map[uint]*asnRelations)
+	get := func(asn uint) *asnRelations {
+		if rel, ok := rels[asn]; ok {
+			return rel
+		}
+		rel := &asnRelations{}
+		rels[asn] = rel
+		return rel
+	}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		parts := strings.Split(text, "|")
+		if len(parts) < 3 {
+			return nil, fmt.Errorf("line %d: expected as1|as2|rel", line)
+		}
+		as1, err1 := parseASN(parts[0])
+		as2, err2 := parseASN(parts[1])
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("line %d: invalid ASN", line)
+		}
+		switch strings.TrimSpace(parts[2]) {
+		case "-1":
+			get(as2).upstreams = append(get(as2).upstreams, as1)
+		case "0":
+			get(as1).peers = append(get(as1).peers, as2)
+			get(as2).peers = append(get(as2).peers, as1)
+		default:
+			return nil, fmt.Errorf("line %d: unknown relationship %q", line, parts[2])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, rel := range rels {
+		slices.Sort(rel.upstreams)
+		rel.upstreams = slices.Compact(rel.upstreams)
+		slices.Sort(rel.peers)
+		rel.peers = slices.Compact(rel.peers)
+	}
+	return rels, nil
+}
+
+// lookupASNRelations 返回 ASN 的上游与对等 ASN（各自最多 maxASNRelations 个），没有数据时返回 nil
+func lookupASNRelations(asn uint) (upstreams, peers []uint) {
+	rel, ok := asnRelationships[asn]
+	if !ok {
+		return nil, nil
+	}
+	// 截断后 Clip，返回的切片追加元素时不会写入共享数据
+	upstreams = slices.Clip(rel.upstreams[:min(len(rel.upstreams), maxASNRelations)])
+	peers = slices.Clip(rel.peers[:min(len(rel.peers), maxASNRelations)])
+	return upstreams, peers
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadASRelationships(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "as-rel.txt")
+	content := "# source:topology|BGP\n174|64500|-1\n3356|64500|-1|bgp\n64500|64501|0\n174|64500|-1\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rels, err := loadASRelationships(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	asnRelationships = rels
+	defer func() { asnRelationships = nil }()
+
+	up, peers := lookupASNRelations(64500)
+	if !reflect.DeepEqual(up, []uint{174, 3356}) || !reflect.DeepEqual(peers, []uint{64501}) {
+		t.Errorf("64500: upstreams = %v, peers = %v", up, peers)
+	}
+	if up, peers := lookupASNRelations(64501); up != nil || !reflect.DeepEqual(peers, []uint{64500}) {
+		t.Errorf("64501: upstreams = %v, peers = %v", up, peers)
+	}
+	if up, peers := lookupASNRelations(15169); up != nil || peers != nil {
+		t.Errorf("unknown ASN: upstreams = %v, peers = %v", up, peers)
+	}
+
+	if err := os.WriteFile(path, []byte("174|64500|2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadASRelationships(path); err == nil {
+		t.Error("expected error for unknown relationship")
+	}
+}
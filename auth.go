@@ -0,0 +1,35 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminToken 为 -admin-token，空表示未开启调试与管理功能
+var adminToken string
+
+// adminAuth 校验 Authorization: Bearer <token> 或 X-API-Key 请求头
+func adminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !hasToken(c, token) {
+			abortWithError(c, http.StatusUnauthorized, ErrCodeUnauthorized, "Unauthorized")
+			return
+		}
+		c.Next()
+	}
+}
+
+// hasToken 判断请求是否携带了正确的 token，token 为空时总是返回 false
+func hasToken(c *gin.Context, token string) bool {
+	if token == "" {
+		return false
+	}
+	got := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if got == "" {
+		got = c.GetHeader("X-API-Key")
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
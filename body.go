@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBodyBytes 为 POST 请求体的上限，由 -max-body 设置
+var maxBodyBytes int64 = 1 << 20
+
+// maxBody 限制请求体大小：声明的 Content-Length 超限时直接返回 413，
+// 分块传输等未声明长度的请求在读取超过上限时报错
+func maxBody(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limit <= 0 {
+			return
+		}
+		if c.Request.ContentLength > limit {
+			abortWithError(c, http.StatusRequestEntityTooLarge, ErrCodePayloadTooLarge,
+				fmt.Sprintf("Request body exceeds %d bytes", limit))
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+	}
+}
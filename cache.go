@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/groupcache/lru"
+)
+
+// newGeoCache 创建记录缓存并统计淘汰次数（含缩容与热加载清空）
+func newGeoCache(size int) *lru.Cache {
+	cache := lru.New(size)
+	cache.OnEvicted = func(key lru.Key, v any) {
+		cacheEvictions.Add(1)
+		if cacheMaxBytes > 0 {
+			cacheBytes -= cacheEntryBytes(key, v.(*geoCacheEntry))
+		}
+	}
+	return cache
+}
+
+// reportCache 每隔 interval 输出一行缓存累计命中率、条目数与淘汰次数，ctx 结束时退出
+func reportCache(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		hits, misses := cacheHits.Load(), cacheMisses.Load()
+		ratio := 0.0
+		if hits+misses > 0 {
+			ratio = float64(hits) / float64(hits+misses)
+		}
+		cacheMutex.Lock()
+		entries, capacity, bytes := geoCache.Len(), geoCache.MaxEntries, cacheBytes
+		cacheMutex.Unlock()
+		if cacheMaxBytes > 0 {
+			log.Printf("INFO: cache hit_ratio=%.4f hits=%d misses=%d entries=%d bytes=%d/%d evictions=%d",
+				ratio, hits, misses, entries, bytes, cacheMaxBytes, cacheEvictions.Load())
+			continue
+		}
+		log.Printf("INFO: cache hit_ratio=%.4f hits=%d misses=%d entries=%d/%d evictions=%d",
+			ratio, hits, misses, entries, capacity, cacheEvictions.Load())
+	}
+}
+
+// resizeCache 调整缓存容量，缩小时按 LRU 顺序淘汰最久未使用的条目
+func resizeCache(size int) (oldSize, entries int) {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+
+	oldSize = geoCache.MaxEntries
+	geoCache.MaxEntries = size
+	for geoCache.Len() > size {
+		geoCache.RemoveOldest()
+	}
+	return oldSize, geoCache.Len()
+}
+
+func cacheResizeHandler(c *gin.Context) {
+	size, err := strconv.Atoi(c.Query("size"))
+	if err != nil || size < 1 {
+		abortWithError(c, http.StatusBadRequest, ErrCodeInvalidParam, "size must be a positive integer")
+		return
+	}
+
+	if geoCache == nil {
+		abortWithError(c, http.StatusConflict, ErrCodeInvalidParam, "Cache is disabled (-cache 0)")
+		return
+	}
+	if cacheMaxBytes > 0 {
+		abortWithError(c, http.StatusConflict, ErrCodeInvalidParam, "Cache is bounded by -cache-bytes; entry count cannot be resized")
+		return
+	}
+
+	oldSize, entries := resizeCache(size)
+	c.JSON(http.StatusOK, gin.H{
+		"old_size": oldSize,
+		"new_size": size,
+		"entries":  entries,
+	})
+}
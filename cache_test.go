@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestResizeCache(t *testing.T) {
+	before := cacheEvictions.Load()
+	geoCache = newGeoCache(10)
+	for i := range 10 {
+		geoCache.Add(fmt.Sprintf("10.0.0.%d", i), &geoCacheEntry{})
+	}
+	// 访问最早的条目，使其成为最近使用
+	geoCache.Get("10.0.0.0")
+
+	oldSize, entries := resizeCache(3)
+	if oldSize != 10 || entries != 3 {
+		t.Fatalf("resizeCache(3) = %d, %d", oldSize, entries)
+	}
+	if got := cacheEvictions.Load() - before; got != 7 {
+		t.Errorf("evictions = %d, want 7", got)
+	}
+	for _, key := range []string{"10.0.0.0", "10.0.0.8", "10.0.0.9"} {
+		if _, ok := geoCache.Get(key); !ok {
+			t.Errorf("expected %s to survive shrink", key)
+		}
+	}
+
+	if _, entries := resizeCache(20); entries != 3 {
+		t.Errorf("growing should keep entries, got %d", entries)
+	}
+	geoCache.Add("10.0.0.100", &geoCacheEntry{})
+	if geoCache.Len() != 4 {
+		t.Errorf("expected 4 entries after growth, got %d", geoCache.Len())
+	}
+}
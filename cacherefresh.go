@@ -0,0 +1,63 @@
+package main
+
+import (
+	"log"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// cacheTTL 大于 0 时写入超过该时长的记录视为未命中（-cache-ttl），0 为永不过期
+	cacheTTL time.Duration
+	// cacheRefreshAhead 为过期前的刷新窗口（-cache-refresh-ahead）：窗口内命中的记录照常返回，
+	// 同时在后台重新查库覆盖，热点记录因此不会过期；0 为关闭
+	cacheRefreshAhead time.Duration
+	// refreshSlots 限制同时进行的后台刷新数，已满时本次命中不触发刷新
+	refreshSlots chan struct{}
+	// refreshing 为正在刷新的记录，IPv6 网段内多个地址命中同一记录时只刷新一次
+	refreshing     sync.Map // *geoCacheEntry → struct{}
+	cacheRefreshes atomic.Uint64
+)
+
+func setCacheRefresh(ttl, ahead time.Duration, workers int) {
+	cacheTTL, cacheRefreshAhead = ttl, ahead
+	refreshSlots = make(chan struct{}, max(workers, 1))
+}
+
+func cacheExpired(e *geoCacheEntry, now time.Time) bool {
+	return cacheTTL > 0 && now.Sub(e.cachedAt) >= cacheTTL
+}
+
+// maybeRefresh 在命中的记录进入刷新窗口时异步重新查询，不阻塞当前请求
+func maybeRefresh(ip netip.Addr, e *geoCacheEntry) {
+	if cacheRefreshAhead <= 0 || time.Since(e.cachedAt) < cacheTTL-cacheRefreshAhead {
+		return
+	}
+	if _, busy := refreshing.LoadOrStore(e, struct{}{}); busy {
+		return
+	}
+	slots := refreshSlots
+	select {
+	case slots <- struct{}{}:
+	default:
+		refreshing.Delete(e)
+		return
+	}
+	go func() {
+		defer func() {
+			<-slots
+			refreshing.Delete(e)
+		}()
+		if cacheOnly() {
+			return
+		}
+		// 只查了国家的记录仍按只查国家刷新，与写入时保持一致
+		if _, err := lookupAndCacheOnce(ip, lookupOptions{skipASN: e.asnSkipped}); err != nil {
+			log.Printf("Background cache refresh failed for %s: %v", ip, err)
+			return
+		}
+		cacheRefreshes.Add(1)
+	}()
+}
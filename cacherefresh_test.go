@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestCacheTTLRefreshAhead(t *testing.T) {
+	geoCache = newGeoCache(10)
+	setCacheRefresh(time.Hour, 10*time.Minute, 1)
+	defer setCacheRefresh(0, 0, 1)
+
+	ip := netip.MustParseAddr("192.0.2.1")
+	put := func(age time.Duration) *geoCacheEntry {
+		e := &geoCacheEntry{}
+		cacheMutex.Lock()
+		cacheAdd(ip.String(), e)
+		cacheMutex.Unlock()
+		e.cachedAt = time.Now().Add(-age)
+		return e
+	}
+
+	put(time.Hour)
+	if _, ok := cacheGet(ip); ok {
+		t.Error("entry older than -cache-ttl should miss")
+	}
+
+	// 刷新窗口外命中不触发刷新
+	fresh := put(time.Minute)
+	if got, err := queryGeo(ip); err != nil || got != fresh {
+		t.Fatalf("queryGeo = %p, %v, want cached entry", got, err)
+	}
+	if len(refreshSlots) != 0 {
+		t.Error("fresh entry should not be refreshed")
+	}
+
+	// 刷新窗口内命中仍返回旧记录，后台写入新记录
+	stale := put(55 * time.Minute)
+	before := cacheRefreshes.Load()
+	if got, err := queryGeo(ip); err != nil || got != stale {
+		t.Fatalf("queryGeo = %p, %v, want the entry being refreshed", got, err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for cacheRefreshes.Load() == before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	got, ok := cacheGet(ip)
+	if !ok || got == stale || time.Since(got.cachedAt) > time.Minute {
+		t.Errorf("entry was not refreshed in the background: %+v", got)
+	}
+}
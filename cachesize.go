@@ -0,0 +1,83 @@
+package main
+
+import (
+	"time"
+	"unsafe"
+
+	"github.com/golang/groupcache/lru"
+	"github.com/oschwald/geoip2-golang/v2"
+)
+
+var (
+	// cacheMaxBytes 大于 0 时按估算的字节数而非条目数淘汰（-cache-bytes）
+	cacheMaxBytes int64
+	// cacheBytes 为当前缓存条目的估算字节数，由 cacheMutex 保护
+	cacheBytes int64
+)
+
+// lruEntryOverhead 为 LRU 链表节点、map 槽位与接口头的大致开销
+const lruEntryOverhead = 128
+
+// newByteGeoCache 创建不限条目数、由 cacheAdd 按估算字节数淘汰的缓存
+func newByteGeoCache(maxBytes int64) *lru.Cache {
+	cacheMaxBytes = maxBytes
+	return newGeoCache(0)
+}
+
+// cacheAdd 写入缓存并记录写入时间，按字节数限制时淘汰最久未使用的条目直到不超过上限；调用方需持有 cacheMutex
+func cacheAdd(key lru.Key, entry *geoCacheEntry) {
+	entry.cachedAt = time.Now()
+	if cacheMaxBytes <= 0 {
+		geoCache.Add(key, entry)
+		return
+	}
+	// 覆盖已有 key 时 lru 不会回调 OnEvicted，需要先扣掉旧记录
+	if old, ok := geoCache.Get(key); ok {
+		cacheBytes -= cacheEntryBytes(key, old.(*geoCacheEntry))
+	}
+	cacheBytes += cacheEntryBytes(key, entry)
+	geoCache.Add(key, entry)
+	// 至少保留刚写入的条目，单条超过上限时也不会反复查库
+	for cacheBytes > cacheMaxBytes && geoCache.Len() > 1 {
+		geoCache.RemoveOldest()
+	}
+}
+
+// cacheEntryBytes 估算一条缓存占用的内存：固定大小的结构体加上各字符串与切片的内容
+func cacheEntryBytes(key lru.Key, e *geoCacheEntry) int64 {
+	n := int64(lruEntryOverhead + unsafe.Sizeof(*e))
+	if s, ok := key.(string); ok {
+		n += int64(len(s))
+	}
+	if r := e.country; r != nil {
+		n += int64(unsafe.Sizeof(*r))
+		n += namesBytes(r.Continent.Names) + namesBytes(r.City.Names) + namesBytes(r.Country.Names) +
+			namesBytes(r.RegisteredCountry.Names) + namesBytes(r.RepresentedCountry.Names)
+		n += int64(len(r.Continent.Code) + len(r.Country.ISOCode) + len(r.RegisteredCountry.ISOCode) +
+			len(r.RepresentedCountry.ISOCode) + len(r.RepresentedCountry.Type) + len(r.Postal.Code) + len(r.Location.TimeZone))
+		for _, s := range r.Subdivisions {
+			n += int64(unsafe.Sizeof(s)) + namesBytes(s.Names) + int64(len(s.ISOCode))
+		}
+	}
+	if r := e.asn; r != nil {
+		n += int64(unsafe.Sizeof(*r)) + int64(len(r.AutonomousSystemOrganization))
+	}
+	if e.confidence != nil {
+		n += int64(unsafe.Sizeof(*e.confidence))
+	}
+	if r := e.asnReg; r != nil {
+		n += int64(unsafe.Sizeof(*r)) + int64(len(r.RIR)+len(r.Country))
+	}
+	if r := e.isp; r != nil {
+		n += int64(unsafe.Sizeof(*r)) + int64(len(r.isp)+len(r.organization)+len(r.connectionType)+len(r.mobileCountryCode)+len(r.mobileNetworkCode))
+	}
+	return n
+}
+
+func namesBytes(names geoip2.Names) int64 {
+	var n int
+	for _, lang := range nameLanguages {
+		n += len(nameIn(names, lang))
+	}
+	return int64(n)
+}
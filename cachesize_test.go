@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/oschwald/geoip2-golang/v2"
+)
+
+func TestCacheEntryBytes(t *testing.T) {
+	bare := cacheEntryBytes("10.0.0.1", &geoCacheEntry{})
+	rich := &geoCacheEntry{country: &geoip2.City{}}
+	rich.country.City.Names = geoip2.Names{English: "Munich", German: "München"}
+	rich.country.Subdivisions = []geoip2.CitySubdivision{{ISOCode: "BY", Names: geoip2.Names{English: "Bavaria"}}}
+	if got := cacheEntryBytes("10.0.0.1", rich); got <= bare {
+		t.Errorf("rich entry %d bytes should exceed bare entry %d bytes", got, bare)
+	}
+}
+
+func TestByteGeoCache(t *testing.T) {
+	defer func() { cacheMaxBytes, cacheBytes = 0, 0 }()
+	entry := func(name string) *geoCacheEntry {
+		e := &geoCacheEntry{country: &geoip2.City{}}
+		e.country.City.Names.English = name
+		return e
+	}
+	per := cacheEntryBytes("10.0.0.0", entry(strings.Repeat("x", 100)))
+	geoCache = newByteGeoCache(per * 3)
+
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	for i := range 5 {
+		cacheAdd(fmt.Sprintf("10.0.0.%d", i), entry(strings.Repeat("x", 100)))
+	}
+	if geoCache.Len() != 3 || cacheBytes != per*3 {
+		t.Fatalf("entries = %d, bytes = %d, want 3 entries and %d bytes", geoCache.Len(), cacheBytes, per*3)
+	}
+	if _, ok := geoCache.Get("10.0.0.0"); ok {
+		t.Error("oldest entry should have been evicted")
+	}
+
+	// 覆盖已有 key 时按新记录重新计算
+	cacheAdd("10.0.0.4", entry("x"))
+	if want := per*2 + cacheEntryBytes("10.0.0.4", entry("x")); cacheBytes != want {
+		t.Errorf("bytes after replace = %d, want %d", cacheBytes, want)
+	}
+
+	geoCache.Clear()
+	if cacheBytes != 0 {
+		t.Errorf("bytes after clear = %d, want 0", cacheBytes)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/golang/groupcache/lru"
+	"github.com/oschwald/geoip2-golang/v2"
+)
+
+// cacheSnapshotVersion 在快照格式变化时递增，旧版本的快照直接丢弃
+const cacheSnapshotVersion = 2
+
+// cacheSnapshot 为 -cache-snapshot 写出的文件内容，Entries 按从旧到新排列
+type cacheSnapshot struct {
+	Version int
+	SavedAt time.Time
+	// Databases 为保存时各数据库的 名称|路径|构建时间，与启动时不一致则整个快照作废
+	Databases []string
+	Entries   []snapshotEntry
+}
+
+// snapshotEntry 为 geoCacheEntry 的可序列化形式
+type snapshotEntry struct {
+	IP            netip.Addr
+	Network       netip.Prefix
+	Country       *geoip2.City
+	ASN           *geoip2.ASN
+	Confidence    *[3]uint8 // country、city、postal
+	ASNReg        *asnRegistration
+	ISP           *[5]string // isp、organization、connection_type、MCC、MNC
+	CountrySource *DataSource
+	ASNSource     *DataSource
+	ISPSource     *DataSource
+	ASNSkipped    bool
+}
+
+// databaseFingerprint 列出当前打开的数据库及其构建时间，调用方需持有 dbMutex 读锁
+func databaseFingerprint() []string {
+	var fp []string
+	for _, spec := range dbSpecs() {
+		if *spec.db != nil {
+			fp = append(fp, fmt.Sprintf("%s|%s|%d", spec.name, spec.path, (*spec.db).Metadata().BuildEpoch))
+		}
+	}
+	return fp
+}
+
+func newSnapshotEntry(ip netip.Addr, e *geoCacheEntry) snapshotEntry {
+	s := snapshotEntry{
+		IP:            ip,
+		Network:       e.network,
+		Country:       e.country,
+		ASN:           e.asn,
+		ASNReg:        e.asnReg,
+		CountrySource: e.countrySource,
+		ASNSource:     e.asnSource,
+		ISPSource:     e.ispSource,
+		ASNSkipped:    e.asnSkipped,
+	}
+	if c := e.confidence; c != nil {
+		s.Confidence = &[3]uint8{c.country, c.city, c.postal}
+	}
+	if i := e.isp; i != nil {
+		s.ISP = &[5]string{i.isp, i.organization, i.connectionType, i.mobileCountryCode, i.mobileNetworkCode}
+	}
+	return s
+}
+
+func (s snapshotEntry) cacheEntry() *geoCacheEntry {
+	e := &geoCacheEntry{
+		country:       s.Country,
+		asn:           s.ASN,
+		asnReg:        s.ASNReg,
+		countrySource: s.CountrySource,
+		asnSource:     s.ASNSource,
+		ispSource:     s.ISPSource,
+		network:       s.Network,
+		asnSkipped:    s.ASNSkipped,
+	}
+	if c := s.Confidence; c != nil {
+		e.confidence = &locationConfidence{country: c[0], city: c[1], postal: c[2]}
+	}
+	if i := s.ISP; i != nil {
+		e.isp = &ispInfo{isp: i[0], organization: i[1], connectionType: i[2], mobileCountryCode: i[3], mobileNetworkCode: i[4]}
+	}
+	return e
+}
+
+// drainCache 按从旧到新的顺序取出并清空全部缓存条目。lru 没有遍历接口，
+// 只能逐个 RemoveOldest，因此仅在退出、不再处理请求时调用
+func drainCache() []snapshotEntry {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+
+	var entries []snapshotEntry
+	onEvicted := geoCache.OnEvicted
+	geoCache.OnEvicted = func(key lru.Key, v any) {
+		var ip netip.Addr
+		switch k := key.(type) {
+		case string:
+			ip, _ = netip.ParseAddr(k)
+		case netip.Prefix:
+			ip = k.Addr()
+		}
+		if ip.IsValid() {
+			entries = append(entries, newSnapshotEntry(ip, v.(*geoCacheEntry)))
+		}
+	}
+	for geoCache.Len() > 0 {
+		geoCache.RemoveOldest()
+	}
+	geoCache.OnEvicted = onEvicted
+	cacheBytes = 0
+	return entries
+}
+
+// saveCacheSnapshot 把缓存写入 path，先写临时文件再改名，避免崩溃时留下半个快照
+func saveCacheSnapshot(path string) (int, error) {
+	dbMutex.RLock()
+	fp := databaseFingerprint()
+	dbMutex.RUnlock()
+	snap := cacheSnapshot{Version: cacheSnapshotVersion, SavedAt: time.Now(), Databases: fp, Entries: drainCache()}
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	if err := gob.NewEncoder(f).Encode(&snap); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	return len(snap.Entries), os.Rename(tmp, path)
+}
+
+// errSnapshotStale 表示快照已过期或数据库已变化，不予加载
+var errSnapshotStale = errors.New("cache snapshot is stale")
+
+// loadCacheSnapshot 读取 path 中的快照写入缓存；快照超过 ttl（0 为不限）、
+// 格式版本不符或任一数据库的构建时间与保存时不同，则返回 errSnapshotStale
+func loadCacheSnapshot(path string, ttl time.Duration) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var snap cacheSnapshot
+	if err := gob.NewDecoder(f).Decode(&snap); err != nil {
+		return 0, fmt.Errorf("decode cache snapshot: %w", err)
+	}
+	if snap.Version != cacheSnapshotVersion {
+		return 0, fmt.Errorf("%w: format version %d", errSnapshotStale, snap.Version)
+	}
+	if age := time.Since(snap.SavedAt); ttl > 0 && age > ttl {
+		return 0, fmt.Errorf("%w: saved %s ago", errSnapshotStale, age.Round(time.Second))
+	}
+
+	dbMutex.RLock()
+	defer dbMutex.RUnlock()
+	if !slices.Equal(snap.Databases, databaseFingerprint()) {
+		return 0, fmt.Errorf("%w: databases changed", errSnapshotStale)
+	}
+
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	for _, s := range snap.Entries {
+		entry := s.cacheEntry()
+		cacheAdd(cacheKey(s.IP, entry), entry)
+	}
+	return len(snap.Entries), nil
+}
+
+// restoreCacheSnapshot 在启动时加载快照，失败只记录日志；加载后删除文件，
+// 避免之后异常退出未写新快照时再次加载过时的内容
+func restoreCacheSnapshot(path string, ttl time.Duration) {
+	n, err := loadCacheSnapshot(path, ttl)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return
+	case err != nil:
+		log.Printf("Discarding cache snapshot %s: %v", path, err)
+	default:
+		log.Printf("Restored %d cache entries from %s", n, path)
+	}
+	if err := os.Remove(path); err != nil {
+		log.Printf("Failed to remove cache snapshot: %v", err)
+	}
+}
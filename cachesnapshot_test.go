@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/gob"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oschwald/geoip2-golang/v2"
+)
+
+func TestCacheSnapshotRoundTrip(t *testing.T) {
+	geoCache = newGeoCache(10)
+	defer func() { ipv6PrefixLens = nil }()
+
+	v4 := &geoCacheEntry{
+		country:    &geoip2.City{},
+		asn:        &geoip2.ASN{AutonomousSystemNumber: 15169, AutonomousSystemOrganization: "GOOGLE"},
+		confidence: &locationConfidence{country: 99, city: 50},
+		isp:        &ispInfo{isp: "Google", connectionType: "Corporate"},
+	}
+	v4.country.Country.ISOCode = "US"
+	v6 := &geoCacheEntry{country: &geoip2.City{}, network: netip.MustParsePrefix("2001:db8::/32"), asnSkipped: true}
+	v6.country.Country.ISOCode = "DE"
+
+	cacheMutex.Lock()
+	cacheAdd(cacheKey(netip.MustParseAddr("8.8.8.8"), v4), v4)
+	cacheAdd(cacheKey(netip.MustParseAddr("2001:db8::1"), v6), v6)
+	cacheMutex.Unlock()
+
+	path := filepath.Join(t.TempDir(), "cache.snap")
+	if n, err := saveCacheSnapshot(path); err != nil || n != 2 {
+		t.Fatalf("saveCacheSnapshot = %d, %v", n, err)
+	}
+	if geoCache.Len() != 0 {
+		t.Fatalf("cache should be drained after save, has %d entries", geoCache.Len())
+	}
+	ipv6PrefixLens = nil
+
+	if n, err := loadCacheSnapshot(path, time.Hour); err != nil || n != 2 {
+		t.Fatalf("loadCacheSnapshot = %d, %v", n, err)
+	}
+	got, ok := cacheGet(netip.MustParseAddr("8.8.8.8"))
+	if !ok || got.country.Country.ISOCode != "US" || got.asn.AutonomousSystemNumber != 15169 ||
+		got.confidence.country != 99 || got.isp.connectionType != "Corporate" {
+		t.Errorf("restored IPv4 entry = %+v", got)
+	}
+	// IPv6 记录仍按网段命中同网段的其他地址
+	got, ok = cacheGet(netip.MustParseAddr("2001:db8:ffff::1"))
+	if !ok || got.country.Country.ISOCode != "DE" || !got.asnSkipped {
+		t.Errorf("restored IPv6 entry = %+v, %v", got, ok)
+	}
+}
+
+func TestCacheSnapshotStale(t *testing.T) {
+	geoCache = newGeoCache(10)
+	dir := t.TempDir()
+	write := func(snap cacheSnapshot) string {
+		path := filepath.Join(dir, "cache.snap")
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := gob.NewEncoder(f).Encode(&snap); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	entries := []snapshotEntry{{IP: netip.MustParseAddr("1.1.1.1"), Country: &geoip2.City{}}}
+
+	for name, snap := range map[string]cacheSnapshot{
+		"Expired":   {Version: cacheSnapshotVersion, SavedAt: time.Now().Add(-2 * time.Hour), Entries: entries},
+		"DBChanged": {Version: cacheSnapshotVersion, SavedAt: time.Now(), Databases: []string{"city|old.mmdb|1"}, Entries: entries},
+		"Version":   {Version: cacheSnapshotVersion + 1, SavedAt: time.Now(), Entries: entries},
+	} {
+		path := write(snap)
+		if _, err := loadCacheSnapshot(path, time.Hour); !errors.Is(err, errSnapshotStale) {
+			t.Errorf("%s: err = %v, want errSnapshotStale", name, err)
+		}
+		if geoCache.Len() != 0 {
+			t.Errorf("%s: stale snapshot loaded %d entries", name, geoCache.Len())
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"net/netip"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+	"github.com/oschwald/geoip2-golang/v2"
+)
+
+var (
+	// compareDB 为 -compare-city-mmdb 指定的候选城市库，仅供 /api/compare 对比新旧版本，不参与正常查询
+	compareDB     *geoip2.Reader
+	compareDBPath string
+)
+
+type compareSide struct {
+	Database   string      `json:"database"`
+	BuildEpoch uint        `json:"build_epoch"`
+	Result     GeoResponse `json:"result"`
+}
+
+type fieldChange struct {
+	Field     string `json:"field"`
+	Baseline  any    `json:"baseline"`
+	Candidate any    `json:"candidate"`
+}
+
+type CompareResponse struct {
+	IP        string        `json:"ip"`
+	Baseline  compareSide   `json:"baseline"`
+	Candidate compareSide   `json:"candidate"`
+	Changed   []fieldChange `json:"changed"`
+	RequestID string        `json:"request_id,omitempty"`
+}
+
+// diffGeoResponses 按 JSON 字段名列出两个响应中取值不同的字段
+func diffGeoResponses(a, b *GeoResponse) []fieldChange {
+	changes := []fieldChange{}
+	va, vb := reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem()
+	for _, name := range geoResponseFieldNames {
+		i := geoResponseFields[name]
+		fa, fb := va.Field(i), vb.Field(i)
+		if !reflect.DeepEqual(fa.Interface(), fb.Interface()) {
+			changes = append(changes, fieldChange{Field: name, Baseline: fa.Interface(), Candidate: fb.Interface()})
+		}
+	}
+	return changes
+}
+
+func compareLookup(r *geoip2.Reader, path string, ip netip.Addr) (compareSide, error) {
+	record, err := r.City(ip)
+	if err != nil {
+		return compareSide{}, err
+	}
+	res := newGeoResponse(ip, &geoCacheEntry{country: record, network: record.Traits.Network})
+	return compareSide{Database: dbSourceName(path), BuildEpoch: buildEpoch(r), Result: res}, nil
+}
+
+// compareHandler 用当前城市库与候选库分别查询同一 IP，并列出有变化的字段，用于在替换前验证新版本。
+// 两边都直接读取 Reader，不经过缓存、覆盖规则与回退库
+func compareHandler(c *gin.Context) {
+	ip, err := parseLookupIP(c.Query("ip"))
+	if err != nil {
+		abortInvalidIP(c, err)
+		return
+	}
+
+	dbMutex.RLock()
+	defer dbMutex.RUnlock()
+	if countryDB == nil || compareDB == nil {
+		abortWithError(c, http.StatusServiceUnavailable, ErrCodeNoData, "Comparison needs both -city-mmdb and -compare-city-mmdb loaded")
+		return
+	}
+
+	baseline, err := compareLookup(countryDB, countryDBPath, ip)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, ErrCodeLookupFailed, "Baseline lookup failed")
+		return
+	}
+	candidate, err := compareLookup(compareDB, compareDBPath, ip)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, ErrCodeLookupFailed, "Candidate lookup failed")
+		return
+	}
+
+	requestID, _ := c.Get("RequestID")
+	id, _ := requestID.(string)
+	c.JSON(http.StatusOK, CompareResponse{
+		IP:        ip.String(),
+		Baseline:  baseline,
+		Candidate: candidate,
+		Changed:   diffGeoResponses(&baseline.Result, &candidate.Result),
+		RequestID: id,
+	})
+}
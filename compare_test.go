@@ -0,0 +1,23 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffGeoResponses(t *testing.T) {
+	a := GeoResponse{IP: "8.8.8.8", CountryCode: "US", City: "Mountain View", AccuracyRadius: 1000}
+	b := GeoResponse{IP: "8.8.8.8", CountryCode: "US", AccuracyRadius: 500}
+
+	got := diffGeoResponses(&a, &b)
+	want := []fieldChange{
+		{Field: "city", Baseline: "Mountain View", Candidate: ""},
+		{Field: "accuracy_radius", Baseline: uint16(1000), Candidate: uint16(500)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diff = %+v, want %+v", got, want)
+	}
+	if got := diffGeoResponses(&a, &a); len(got) != 0 {
+		t.Errorf("identical responses diff = %+v", got)
+	}
+}
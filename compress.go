@@ -0,0 +1,188 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	encodingBrotli = "br"
+	encodingGzip   = "gzip"
+)
+
+// compressEncoder 为 gzip.Writer 与 brotli.Writer 的共同方法，流式接口 Flush 时需要先刷出压缩器
+type compressEncoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+var (
+	gzipPool   = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+	brotliPool = sync.Pool{New: func() any { return brotli.NewWriterLevel(nil, brotli.DefaultCompression) }}
+)
+
+// negotiateEncoding 按 Accept-Encoding 的 q 值在 br 与 gzip 中选择，q 相同时优先 br；
+// 两者都不可接受时返回空串，即不压缩
+func negotiateEncoding(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != encodingBrotli && name != encodingGzip {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = f
+		}
+		if q > bestQ || (q == bestQ && q > 0 && name == encodingBrotli) {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// compressMiddleware 在响应体达到 minBytes 时按协商结果压缩，较小的响应原样返回；
+// 已设置 Content-Encoding（如 /metrics 自行压缩）或返回部分内容的响应不再处理
+func compressMiddleware(minBytes int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		w := &compressWriter{ResponseWriter: c.Writer, encoding: encoding, minBytes: minBytes}
+		c.Writer = w
+		defer func() {
+			w.finish()
+			c.Writer = w.ResponseWriter
+		}()
+		c.Next()
+	}
+}
+
+// compressWriter 先缓冲响应体，超过阈值或被 Flush 时才决定是否压缩并写出响应头
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	minBytes int
+	buf      []byte
+	decided  bool
+	enc      compressEncoder
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < w.minBytes {
+			return len(b), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if w.enc != nil {
+		return w.enc.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Written 把尚在缓冲中的内容也视为已写出，与直接写入时的语义一致
+func (w *compressWriter) Written() bool {
+	return len(w.buf) > 0 || w.ResponseWriter.Written()
+}
+
+// Flush 用于流式接口：已有内容时立即开始压缩，之后每次 Flush 都刷出压缩器
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if len(w.buf) == 0 {
+			return
+		}
+		if err := w.decide(true); err != nil {
+			return
+		}
+	}
+	if w.enc != nil {
+		w.enc.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// WriteHeaderNow 提前发送响应头时已无法再加 Content-Encoding，按不压缩处理
+func (w *compressWriter) WriteHeaderNow() {
+	if !w.decided {
+		w.decide(false)
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// Unwrap 让 http.ResponseController 能找到底层连接，流式接口依赖它取消写超时
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// decide 确定是否压缩并写出缓冲的内容，之后的写入不再缓冲
+func (w *compressWriter) decide(compress bool) error {
+	w.decided = true
+	h := w.Header()
+	if compress && h.Get("Content-Encoding") == "" && h.Get("Content-Range") == "" && w.Status() != http.StatusPartialContent {
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		if w.encoding == encodingBrotli {
+			w.enc = brotliPool.Get().(compressEncoder)
+		} else {
+			w.enc = gzipPool.Get().(compressEncoder)
+		}
+		w.enc.Reset(w.ResponseWriter)
+	}
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.enc != nil {
+		_, err = w.enc.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// finish 在 handler 返回后写出未达阈值的缓冲内容或结束压缩流
+func (w *compressWriter) finish() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.enc == nil {
+		return
+	}
+	w.enc.Close()
+	w.enc.Reset(nil)
+	if w.encoding == encodingBrotli {
+		brotliPool.Put(w.enc)
+	} else {
+		gzipPool.Put(w.enc)
+	}
+	w.enc = nil
+}
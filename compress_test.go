@@ -0,0 +1,134 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                       "",
+		"identity":               "",
+		"gzip":                   "gzip",
+		"gzip, deflate, br":      "br",
+		"br;q=0.5, gzip":         "gzip",
+		"gzip;q=0.8, br;q=0.9":   "br",
+		"br;q=0, gzip;q=0":       "",
+		"BR":                     "br",
+		"gzip;q=bad, br;q=0.1":   "br",
+		"deflate, gzip;q=0.5, *": "gzip",
+	}
+	for header, want := range tests {
+		if got := negotiateEncoding(header); got != want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestCompressMiddleware(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(compressMiddleware(64))
+	large := strings.Repeat("203.0.113.1,US\n", 100)
+	r.GET("/large", func(c *gin.Context) { c.String(http.StatusOK, large) })
+	r.GET("/small", func(c *gin.Context) { c.String(http.StatusOK, "US") })
+	r.GET("/stream", func(c *gin.Context) {
+		c.Writer.WriteString("first")
+		c.Writer.Flush()
+		c.Writer.WriteString("second")
+	})
+
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set("Accept-Encoding", accept)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, tc := range []struct {
+		accept, encoding string
+		decode           func(io.Reader) (io.Reader, error)
+	}{
+		{"gzip, br", "br", func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil }},
+		{"gzip", "gzip", func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+	} {
+		w := get("/large", tc.accept)
+		if got := w.Header().Get("Content-Encoding"); got != tc.encoding {
+			t.Fatalf("Accept-Encoding %q: Content-Encoding = %q, want %q", tc.accept, got, tc.encoding)
+		}
+		if w.Body.Len() >= len(large) {
+			t.Errorf("%s body not smaller: %d bytes", tc.encoding, w.Body.Len())
+		}
+		zr, err := tc.decode(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(zr)
+		if err != nil || string(body) != large {
+			t.Errorf("%s roundtrip failed: %v", tc.encoding, err)
+		}
+	}
+
+	w := get("/small", "br")
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != "US" {
+		t.Errorf("small response: Content-Encoding = %q, body = %q", w.Header().Get("Content-Encoding"), w.Body.String())
+	}
+	if !slices.Contains(w.Header().Values("Vary"), "Accept-Encoding") {
+		t.Errorf("Vary = %q", w.Header().Values("Vary"))
+	}
+
+	w = get("/large", "identity")
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != large {
+		t.Errorf("identity: Content-Encoding = %q", w.Header().Get("Content-Encoding"))
+	}
+
+	// 流式接口在 Flush 时即使未达阈值也开始压缩
+	w = get("/stream", "gzip")
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("stream: Content-Encoding = %q", w.Header().Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(zr); string(body) != "firstsecond" {
+		t.Errorf("stream body = %q", body)
+	}
+}
+
+// geoHandler 追加的 Vary: Accept-Language 不能覆盖压缩中间件的 Vary: Accept-Encoding，
+// 否则共享缓存会把压缩后的响应返回给不支持该编码的客户端
+func TestCompressedGeoHandlerVary(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := newRouter(false, 0)
+	r.Use(compressMiddleware(1))
+	r.GET("/api/ipinfo", geoHandler)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/ipinfo?ip=127.0.0.1", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("status = %d, Content-Encoding = %q", w.Code, w.Header().Get("Content-Encoding"))
+	}
+	vary := w.Header().Values("Vary")
+	if !slices.Contains(vary, "Accept-Encoding") || !slices.Contains(vary, "Accept-Language") {
+		t.Errorf("Vary = %q, want both Accept-Encoding and Accept-Language", vary)
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, err := io.ReadAll(zr); err != nil || !strings.Contains(string(body), `"ip":"127.0.0.1"`) {
+		t.Errorf("body = %q, %v", body, err)
+	}
+}
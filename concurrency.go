@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// concurrencyExempt 为不受 -max-concurrent 限制的路径，过载时健康检查与监控仍能如实反映状态
+var concurrencyExempt = map[string]bool{
+	"/healthz":          true,
+	"/readyz":           true,
+	"/metrics":          true,
+	"/api/metrics.json": true,
+}
+
+// concurrencyLimiter 限制同时处理的请求数，超出时立即返回 503 并带 Retry-After，
+// 不让 goroutine 在过载时继续堆积
+func concurrencyLimiter(limit int) gin.HandlerFunc {
+	sem := make(chan struct{}, limit)
+	return func(c *gin.Context) {
+		if concurrencyExempt[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
+		select {
+		case sem <- struct{}{}:
+		default:
+			c.Header("Retry-After", "1")
+			abortWithError(c, http.StatusServiceUnavailable, ErrCodeOverloaded, "Too many concurrent requests")
+			return
+		}
+		defer func() { <-sem }()
+		c.Next()
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// countryHandler 只返回两位国家代码的纯文本，便于 shell、防火墙规则直接使用；
+// 没有国家信息时返回 204
+func countryHandler(c *gin.Context) {
+	ip, err := requestedIP(c)
+	if err != nil {
+		abortInvalidIP(c, err)
+		return
+	}
+
+	entry, err := tracedQueryGeo(c.Request.Context(), ip, lookupOptions{skipASN: true})
+	if errors.Is(err, errDBUnavailable) {
+		abortWithError(c, http.StatusServiceUnavailable, ErrCodeDBUnavailable, "Database unavailable")
+		return
+	}
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, ErrCodeLookupFailed, "GeoIP lookup failed")
+		return
+	}
+
+	code := entry.country.Country.ISOCode
+	if code == "" {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	c.String(http.StatusOK, "%s\n", code)
+}
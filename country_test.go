@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCountryHandler(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.GET("/api/country", countryHandler)
+
+	// 用覆盖规则提供数据，无需加载数据库
+	list := []override{{prefix: netip.MustParsePrefix("203.0.113.0/24"), countryCode: "JP", asn: 64500}}
+	overrides.Store(&list)
+	defer overrides.Store(nil)
+
+	testCases := []struct {
+		ip     string
+		status int
+		body   string
+	}{
+		{"203.0.113.7", http.StatusOK, "JP\n"},
+		{"198.51.100.1", http.StatusNoContent, ""},
+		{"not-an-ip", http.StatusBadRequest, ""},
+	}
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/country?ip="+tc.ip, nil)
+		r.ServeHTTP(w, req)
+		if w.Code != tc.status {
+			t.Errorf("%s: status %d, want %d", tc.ip, w.Code, tc.status)
+		}
+		if tc.body != "" && w.Body.String() != tc.body {
+			t.Errorf("%s: body %q, want %q", tc.ip, w.Body.String(), tc.body)
+		}
+	}
+}
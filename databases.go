@@ -0,0 +1,110 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	"github.com/oschwald/geoip2-golang/v2"
+)
+
+var (
+	// dbMutex 保护 countryDB/asnDB/ispDB 指针：查询期间持读锁，
+	// 热加载时持写锁替换指针，之后再关闭旧库，保证不会关闭正在使用的 reader
+	dbMutex   sync.RWMutex
+	asnDBPath string
+	ispDBPath string
+)
+
+type dbSpec struct {
+	name       string
+	path       string
+	db         **geoip2.Reader
+	enterprise *bool
+	health     *dbHealth
+}
+
+func dbSpecs() []dbSpec {
+	specs := []dbSpec{
+		{"city", countryDBPath, &countryDB, &countryDBEnterprise, &countryHealth},
+		{"ASN", asnDBPath, &asnDB, nil, &asnHealth},
+		{"ISP", ispDBPath, &ispDB, &ispDBEnterprise, nil},
+	}
+	if compareDBPath != "" {
+		specs = append(specs, dbSpec{"compare city", compareDBPath, &compareDB, nil, nil})
+	}
+	for _, fb := range cityFallbacks {
+		specs = append(specs, dbSpec{"city fallback", fb.path, &fb.db, nil, nil})
+	}
+	for _, fb := range asnFallbacks {
+		specs = append(specs, dbSpec{"ASN fallback", fb.path, &fb.db, nil, nil})
+	}
+	return specs
+}
+
+// reloadDatabases 重新打开所有已配置的数据库，单个库打开失败时保留旧库继续服务。
+// 有任一库被替换时清空记录缓存，避免返回旧库的数据
+func reloadDatabases() {
+	reloading.Store(true)
+	defer reloading.Store(false)
+
+	var old []*geoip2.Reader
+	for _, spec := range dbSpecs() {
+		if spec.path == "" {
+			continue
+		}
+		r, err := openMMDB(spec.path)
+		if err != nil {
+			log.Printf("Failed to reload %s mmdb, keeping previous: %v", spec.name, err)
+			continue
+		}
+
+		dbMutex.RLock()
+		cur := *spec.db
+		dbMutex.RUnlock()
+		if cur != nil {
+			if err := checkReplacement(cur.Metadata(), r.Metadata(), reloadMaxNodeDrop); err != nil {
+				log.Printf("Refusing to reload %s mmdb %s, keeping previous: %v", spec.name, spec.path, err)
+				r.Close()
+				continue
+			}
+		}
+
+		dbMutex.Lock()
+		if *spec.db != nil {
+			old = append(old, *spec.db)
+		}
+		*spec.db = r
+		if spec.enterprise != nil {
+			*spec.enterprise = isEnterpriseDB(r)
+		}
+		dbMutex.Unlock()
+
+		if spec.health != nil {
+			spec.health.reset()
+		}
+		log.Printf("Reloaded %s mmdb %s (build %s)", spec.name, spec.path, r.Metadata().BuildTime().UTC().Format("2006-01-02T15:04:05Z"))
+	}
+
+	if len(old) == 0 {
+		return
+	}
+	if geoCache != nil {
+		cacheMutex.Lock()
+		geoCache.Clear()
+		cacheMutex.Unlock()
+	}
+	for _, r := range old {
+		r.Close()
+	}
+}
+
+func closeDatabases() {
+	dbMutex.Lock()
+	defer dbMutex.Unlock()
+	for _, spec := range dbSpecs() {
+		if *spec.db != nil {
+			(*spec.db).Close()
+			*spec.db = nil
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// lookupTimeout 为缓存未命中时单次数据库查询的最长等待时间，0 表示不限制
+	lookupTimeout time.Duration
+	// lookupTimeouts 统计因超时而放弃等待的查询次数
+	lookupTimeouts atomic.Uint64
+
+	errLookupTimeout = fmt.Errorf("%w: lookup timed out", errDBUnavailable)
+)
+
+// withLookupDeadline 在独立 goroutine 中执行 fn，超过 lookupTimeout 时先行返回 errLookupTimeout。
+// mmdb 的缺页读取无法中断，fn 会在后台继续完成并照常写入缓存，后续请求即可命中
+func withLookupDeadline(fn func() (*geoCacheEntry, error)) (*geoCacheEntry, error) {
+	if lookupTimeout <= 0 {
+		return fn()
+	}
+
+	type result struct {
+		entry *geoCacheEntry
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		entry, err := fn()
+		done <- result{entry, err}
+	}()
+
+	timer := time.NewTimer(lookupTimeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.entry, r.err
+	case <-timer.C:
+		lookupTimeouts.Add(1)
+		return nil, errLookupTimeout
+	}
+}
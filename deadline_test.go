@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWithLookupDeadline(t *testing.T) {
+	old := lookupTimeout
+	defer func() { lookupTimeout = old }()
+	lookupTimeout = 20 * time.Millisecond
+
+	want := &geoCacheEntry{}
+	entry, err := withLookupDeadline(func() (*geoCacheEntry, error) { return want, nil })
+	if err != nil || entry != want {
+		t.Fatalf("fast lookup = %v, %v", entry, err)
+	}
+
+	before := lookupTimeouts.Load()
+	release := make(chan struct{})
+	defer close(release)
+	_, err = withLookupDeadline(func() (*geoCacheEntry, error) {
+		<-release
+		return want, nil
+	})
+	if !errors.Is(err, errLookupTimeout) || !errors.Is(err, errDBUnavailable) {
+		t.Fatalf("slow lookup err = %v, want errLookupTimeout", err)
+	}
+	if got := lookupTimeouts.Load() - before; got != 1 {
+		t.Errorf("lookupTimeouts increased by %d, want 1", got)
+	}
+}
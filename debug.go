@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type rawLookup struct {
+	DatabaseType string `json:"database_type"`
+	BuildEpoch   uint   `json:"build_epoch"`
+	Record       any    `json:"record,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// rawHandler 绕过缓存与覆盖规则，直接返回数据库解码出的完整记录，用于排查字段映射问题
+func rawHandler(c *gin.Context) {
+	ip, err := parseLookupIP(c.Query("ip"))
+	if err != nil {
+		abortInvalidIP(c, err)
+		return
+	}
+
+	// db 为空时查询所有已加载的库，否则只查指定的一个
+	db := c.Query("db")
+	if db != "" && db != "city" && db != "asn" && db != "isp" {
+		abortWithError(c, http.StatusBadRequest, ErrCodeInvalidParam, "db must be city, asn or isp")
+		return
+	}
+	want := func(name string) bool { return db == "" || db == name }
+
+	res := gin.H{"ip": ip.String()}
+
+	dbMutex.RLock()
+	defer dbMutex.RUnlock()
+
+	if want("city") && countryDB != nil {
+		meta := countryDB.Metadata()
+		city := rawLookup{DatabaseType: meta.DatabaseType, BuildEpoch: meta.BuildEpoch}
+		if countryDBEnterprise {
+			city.Record, err = countryDB.Enterprise(ip)
+		} else {
+			city.Record, err = countryDB.City(ip)
+		}
+		if err != nil {
+			city.Error = err.Error()
+		}
+		res["city"] = city
+	}
+
+	if want("asn") && asnDB != nil {
+		meta := asnDB.Metadata()
+		asn := rawLookup{DatabaseType: meta.DatabaseType, BuildEpoch: meta.BuildEpoch}
+		if asn.Record, err = asnDB.ASN(ip); err != nil {
+			asn.Error = err.Error()
+		}
+		res["asn"] = asn
+	}
+
+	if want("isp") && ispDB != nil {
+		meta := ispDB.Metadata()
+		isp := rawLookup{DatabaseType: meta.DatabaseType, BuildEpoch: meta.BuildEpoch}
+		if ispDBEnterprise {
+			isp.Record, err = ispDB.Enterprise(ip)
+		} else {
+			isp.Record, err = ispDB.ISP(ip)
+		}
+		if err != nil {
+			isp.Error = err.Error()
+		}
+		res["isp"] = isp
+	}
+
+	// 只有 ip 一项说明要查询的库都未加载
+	if len(res) == 1 {
+		abortWithError(c, http.StatusServiceUnavailable, ErrCodeNoData, "Database not loaded")
+		return
+	}
+
+	requestID, _ := c.Get("RequestID")
+	res["request_id"] = requestID
+	c.JSON(http.StatusOK, res)
+}
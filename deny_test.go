@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/oschwald/geoip2-golang/v2"
+)
+
+func TestParseDenyList(t *testing.T) {
+	if d, err := parseDenyList("", " , "); d != nil || err != nil {
+		t.Errorf("empty lists = %v, %v", d, err)
+	}
+	d, err := parseDenyList("kp, IR", "AS64500,64501")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.countries) != 2 || len(d.asns) != 2 {
+		t.Errorf("got %d countries, %d asns", len(d.countries), len(d.asns))
+	}
+	if _, err := parseDenyList("USA", ""); err == nil {
+		t.Error("expected error for three-letter code")
+	}
+	if _, err := parseDenyList("", "ASX"); err == nil {
+		t.Error("expected error for invalid ASN")
+	}
+}
+
+func TestDenyListDenies(t *testing.T) {
+	d, _ := parseDenyList("KP", "64500")
+	kp := &geoCacheEntry{country: &geoip2.City{}}
+	kp.country.Country.ISOCode = "KP"
+	if !d.denies(kp) {
+		t.Error("country should be denied")
+	}
+	as := &geoCacheEntry{country: &geoip2.City{}, asn: &geoip2.ASN{AutonomousSystemNumber: 64500}}
+	if !d.denies(as) {
+		t.Error("ASN should be denied")
+	}
+	if d.denies(&geoCacheEntry{country: &geoip2.City{}}) {
+		t.Error("empty entry should be allowed")
+	}
+}
+
+func TestDenyMiddlewareExemptsLocal(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	d, _ := parseDenyList("KP", "")
+	r := gin.New()
+	r.GET("/", denyMiddleware(d), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, remote := range []string{"127.0.0.1:1234", "192.168.1.5:1234", "[::1]:1234"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remote
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: status = %d, want 200", remote, w.Code)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type downloadConfig struct {
+	// timeout 为单次请求（含读取响应体）的总时长上限
+	timeout time.Duration
+	// proxy 为空时遵循 HTTPS_PROXY / HTTP_PROXY / NO_PROXY 环境变量
+	proxy string
+	// retries 为临时失败（网络错误、429、5xx）后的重试次数，间隔从 backoff 起按倍数增长
+	retries int
+	backoff time.Duration
+}
+
+// newDownloadClient 创建拉取远端文件（如启动时从 URL 下载数据库）时共用的 HTTP 客户端，
+// 避免各处直接使用没有超时的 http.DefaultClient
+func newDownloadClient(cfg downloadConfig) (*http.Client, error) {
+	proxy := http.ProxyFromEnvironment
+	if cfg.proxy != "" {
+		u, err := url.Parse(cfg.proxy)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", cfg.proxy)
+		}
+		proxy = http.ProxyURL(u)
+	}
+	transport := &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          4,
+		MaxIdleConnsPerHost:   2,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+	}
+	return &http.Client{Timeout: cfg.timeout, Transport: transport}, nil
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// fetchRequestWithRetry 发起请求，临时失败时按指数退避重试；返回 2xx 响应，调用方负责关闭 Body。
+// 每次尝试都调用 newRequest 重新构造请求，便于附加条件请求头或按当前时间签名；带条件请求头时 304 同样作为成功返回
+func fetchRequestWithRetry(ctx context.Context, client *http.Client, cfg downloadConfig, newRequest func(context.Context) (*http.Request, error)) (*http.Response, error) {
+	delay := cfg.backoff
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest(ctx)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if ue, ok := err.(*url.Error); ok {
+			ue.URL = redactURL(req.URL)
+		}
+		if err == nil {
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 || resp.StatusCode == http.StatusNotModified {
+				return resp, nil
+			}
+			resp.Body.Close()
+			err = fmt.Errorf("GET %s: %s", redactURL(req.URL), resp.Status)
+			if !retryableStatus(resp.StatusCode) {
+				return nil, err
+			}
+		}
+		if attempt >= cfg.retries {
+			return nil, err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
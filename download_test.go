@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetchRequestWithRetry(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/flaky":
+			if calls.Add(1) < 3 {
+				http.Error(w, "busy", http.StatusServiceUnavailable)
+				return
+			}
+			io.WriteString(w, "ok")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := downloadConfig{timeout: 5 * time.Second, retries: 3, backoff: time.Millisecond}
+	client, err := newDownloadClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path string) (*http.Response, error) {
+		return fetchRequestWithRetry(context.Background(), client, cfg, func(ctx context.Context) (*http.Request, error) {
+			return http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+path, nil)
+		})
+	}
+
+	resp, err := get("/flaky")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "ok" || calls.Load() != 3 {
+		t.Errorf("body = %q after %d calls", body, calls.Load())
+	}
+
+	// 404 不是临时失败，不重试
+	if _, err := get("/missing"); err == nil {
+		t.Error("expected error for 404")
+	}
+
+	if _, err := newDownloadClient(downloadConfig{proxy: "::bad"}); err == nil {
+		t.Error("expected error for invalid proxy")
+	}
+}
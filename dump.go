@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"time"
+)
+
+// dumpState 输出当前运行状态快照：缓存、命中计数、数据库构建时间与 goroutine 数
+func dumpState(w io.Writer) {
+	cacheLen, cacheMax := 0, 0
+	if geoCache != nil {
+		cacheMutex.Lock()
+		cacheLen, cacheMax = geoCache.Len(), geoCache.MaxEntries
+		cacheMutex.Unlock()
+	}
+
+	dbMutex.RLock()
+	cityEpoch, asnEpoch, ispEpoch := buildEpoch(countryDB), buildEpoch(asnDB), buildEpoch(ispDB)
+	dbMutex.RUnlock()
+
+	fmt.Fprintf(w, "[STATE] %s | uptime=%s requests=%d cache=%d/%d hits=%d misses=%d city_epoch=%d asn_epoch=%d isp_epoch=%d goroutines=%d\n",
+		time.Now().Format("2006/01/02 - 15:04:05"),
+		time.Since(startTime).Round(time.Second),
+		requestsTotal.Load(),
+		cacheLen, cacheMax,
+		cacheHits.Load(), cacheMisses.Load(),
+		cityEpoch, asnEpoch, ispEpoch,
+		runtime.NumGoroutine(),
+	)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/golang/groupcache/lru"
+)
+
+func TestDumpState(t *testing.T) {
+	oldCache := geoCache
+	defer func() { geoCache = oldCache }()
+
+	geoCache = lru.New(100)
+	geoCache.Add("8.8.8.8", &geoCacheEntry{})
+
+	var buf bytes.Buffer
+	dumpState(&buf)
+	out := buf.String()
+	for _, want := range []string{"[STATE]", "cache=1/100", "hits=", "misses=", "city_epoch=", "goroutines="} {
+		if !strings.Contains(out, want) {
+			t.Errorf("dump missing %q: %s", want, out)
+		}
+	}
+
+	// 关闭缓存时不应 panic
+	geoCache = nil
+	buf.Reset()
+	dumpState(&buf)
+	if !strings.Contains(buf.String(), "cache=0/0") {
+		t.Errorf("unexpected dump with cache disabled: %s", buf.String())
+	}
+}
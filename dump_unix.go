@@ -0,0 +1,19 @@
+//go:build !windows
+
+package main
+
+import (
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// handleDump 收到 SIGUSR1 时将状态快照写入日志，用法：kill -USR1 <pid>
+func handleDump(w io.Writer) {
+	usr1 := make(chan os.Signal, 1)
+	signal.Notify(usr1, syscall.SIGUSR1)
+	for range usr1 {
+		dumpState(w)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+import "io"
+
+// Windows 没有 SIGUSR1，不提供状态转储
+func handleDump(w io.Writer) {}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/netip"
+	"strings"
+
+	"github.com/oschwald/geoip2-golang/v2"
+)
+
+// countryDBEnterprise 为 true 时使用 Enterprise 查询以获得置信度字段
+var countryDBEnterprise bool
+
+type locationConfidence struct {
+	country uint8
+	city    uint8
+	postal  uint8
+}
+
+func isEnterpriseDB(r *geoip2.Reader) bool {
+	return strings.Contains(r.Metadata().DatabaseType, "Enterprise")
+}
+
+// lookupEnterprise 使用 Enterprise 查询并转换为 City 结构，额外返回置信度
+func lookupEnterprise(ip netip.Addr) (*geoip2.City, *locationConfidence, error) {
+	e, err := countryDB.Enterprise(ip)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	city := &geoip2.City{
+		Continent:          e.Continent,
+		RepresentedCountry: e.RepresentedCountry,
+		RegisteredCountry:  e.RegisteredCountry,
+		Location:           e.Location,
+	}
+	city.Traits.IPAddress = e.Traits.IPAddress
+	city.Traits.Network = e.Traits.Network
+	city.Traits.IsAnycast = e.Traits.IsAnycast
+	city.Postal.Code = e.Postal.Code
+	city.City.Names = e.City.Names
+	city.City.GeoNameID = e.City.GeoNameID
+	city.Country.Names = e.Country.Names
+	city.Country.ISOCode = e.Country.ISOCode
+	city.Country.GeoNameID = e.Country.GeoNameID
+	city.Country.IsInEuropeanUnion = e.Country.IsInEuropeanUnion
+	for _, sub := range e.Subdivisions {
+		city.Subdivisions = append(city.Subdivisions, geoip2.CitySubdivision{
+			Names:     sub.Names,
+			ISOCode:   sub.ISOCode,
+			GeoNameID: sub.GeoNameID,
+		})
+	}
+
+	return city, &locationConfidence{
+		country: e.Country.Confidence,
+		city:    e.City.Confidence,
+		postal:  e.Postal.Confidence,
+	}, nil
+}
@@ -0,0 +1,22 @@
+package main
+
+// envelopeDefault 为 -envelope 指定的默认响应形态，请求中的 ?envelope= 优先
+var envelopeDefault bool
+
+type responseMeta struct {
+	RequestID string    `json:"request_id,omitempty"`
+	Timestamp Timestamp `json:"timestamp,omitempty"`
+}
+
+// responseEnvelope 为 {"data": {...}, "meta": {...}} 形式的响应，request_id 与 timestamp 移入 meta
+type responseEnvelope struct {
+	Data any          `json:"data"`
+	Meta responseMeta `json:"meta"`
+}
+
+// envelopeParts 拆出 meta，返回去掉请求相关字段后的响应副本，供 data 使用（可再经 responseBody 裁剪）
+func envelopeParts(res GeoResponse) (GeoResponse, responseMeta) {
+	meta := responseMeta{RequestID: res.RequestID, Timestamp: res.Timestamp}
+	res.RequestID, res.Timestamp = "", 0
+	return res, meta
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGeoHandlerEnvelope(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(requestIDMiddleware())
+	r.GET("/api/ipinfo", geoHandler)
+
+	get := func(query string) (int, map[string]json.RawMessage) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/ipinfo"+query, nil)
+		r.ServeHTTP(w, req)
+		var body map[string]json.RawMessage
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body
+	}
+
+	code, body := get("?ip=127.0.0.1&envelope=true&fields=ip,request_id")
+	if code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	var data map[string]any
+	var meta responseMeta
+	json.Unmarshal(body["data"], &data)
+	json.Unmarshal(body["meta"], &meta)
+	if data["ip"] != "127.0.0.1" || data["request_id"] != nil {
+		t.Errorf("data = %v", data)
+	}
+	if meta.RequestID == "" || meta.Timestamp == 0 {
+		t.Errorf("meta = %+v", meta)
+	}
+
+	// 默认保持扁平结构，-envelope 可被 ?envelope=false 覆盖
+	if _, body := get("?ip=127.0.0.1"); body["data"] != nil || body["request_id"] == nil {
+		t.Errorf("flat response = %v", body)
+	}
+	envelopeDefault = true
+	defer func() { envelopeDefault = false }()
+	if _, body := get("?ip=127.0.0.1"); body["meta"] == nil {
+		t.Errorf("-envelope response = %v", body)
+	}
+	if _, body := get("?ip=127.0.0.1&envelope=false"); body["meta"] != nil {
+		t.Errorf("?envelope=false response = %v", body)
+	}
+	if code, _ := get("?ip=127.0.0.1&envelope=maybe"); code != http.StatusBadRequest {
+		t.Errorf("invalid envelope status = %d", code)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 机器可读的错误码，客户端可据此分支处理而无需匹配错误文案
+const (
+	ErrCodeInvalidIP            = "INVALID_IP"
+	ErrCodeInvalidASN           = "INVALID_ASN"
+	ErrCodeInvalidParam         = "INVALID_PARAM"
+	ErrCodeLookupFailed         = "LOOKUP_FAILED"
+	ErrCodeDBUnavailable        = "DB_UNAVAILABLE"
+	ErrCodeOverloaded           = "OVERLOADED"
+	ErrCodeNoData               = "NO_DATA"
+	ErrCodeUnauthorized         = "UNAUTHORIZED"
+	ErrCodeForbidden            = "FORBIDDEN"
+	ErrCodeNotFound             = "NOT_FOUND"
+	ErrCodeMethodNotAllowed     = "METHOD_NOT_ALLOWED"
+	ErrCodeRateLimited          = "RATE_LIMITED"
+	ErrCodeUnsupportedMediaType = "UNSUPPORTED_MEDIA_TYPE"
+	ErrCodePayloadTooLarge      = "PAYLOAD_TOO_LARGE"
+	ErrCodeInternal             = "INTERNAL_ERROR"
+)
+
+type ErrorResponse struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// abortWithError 以统一的错误结构响应并终止后续 handler
+func abortWithError(c *gin.Context, status int, code, message string) {
+	requestID, _ := c.Get("RequestID")
+	id, _ := requestID.(string)
+	c.AbortWithStatusJSON(status, ErrorResponse{Code: code, Message: message, RequestID: id})
+}
+
+func notFoundHandler(c *gin.Context) {
+	abortWithError(c, http.StatusNotFound, ErrCodeNotFound, "Not found")
+}
+
+// methodNotAllowedHandler 的 Allow 响应头由 gin 在调用前设置
+func methodNotAllowedHandler(c *gin.Context) {
+	abortWithError(c, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNoRouteAndNoMethod(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.HandleMethodNotAllowed = true
+	r.NoRoute(notFoundHandler)
+	r.NoMethod(methodNotAllowedHandler)
+	r.Use(requestIDMiddleware())
+	r.GET("/api/ipinfo", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	testCases := []struct {
+		method string
+		path   string
+		status int
+		code   string
+		allow  string
+	}{
+		{"GET", "/nope", http.StatusNotFound, ErrCodeNotFound, ""},
+		{"POST", "/api/ipinfo", http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "GET"},
+	}
+
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(tc.method, tc.path, nil)
+		r.ServeHTTP(w, req)
+
+		if w.Code != tc.status {
+			t.Fatalf("%s %s: status %d, want %d", tc.method, tc.path, w.Code, tc.status)
+		}
+		var res ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatalf("%s %s: invalid JSON body %q", tc.method, tc.path, w.Body.String())
+		}
+		if res.Code != tc.code || res.RequestID == "" {
+			t.Errorf("%s %s: got %+v", tc.method, tc.path, res)
+		}
+		if got := w.Header().Get("Allow"); got != tc.allow {
+			t.Errorf("%s %s: Allow = %q, want %q", tc.method, tc.path, got, tc.allow)
+		}
+	}
+}
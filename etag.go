@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/oschwald/geoip2-golang/v2"
+)
+
+func buildEpoch(r *geoip2.Reader) uint {
+	if r == nil {
+		return 0
+	}
+	return r.Metadata().BuildEpoch
+}
+
+// geoETag 对去掉时间戳、RequestID 后的响应内容及各数据库构建时间计算弱 ETag，
+// 数据库重新加载后构建时间变化，ETag 随之变化。variant 区分同一响应的不同呈现（字段选择、JSONP 回调）
+func geoETag(res GeoResponse, variant string) string {
+	res.Timestamp = 0
+	res.RequestID = ""
+	b, _ := json.Marshal(res)
+
+	h := fnv.New64a()
+	h.Write(b)
+	dbMutex.RLock()
+	fmt.Fprintf(h, "|%s|%d|%d|%d", variant, buildEpoch(countryDB), buildEpoch(asnDB), buildEpoch(ispDB))
+	dbMutex.RUnlock()
+	return fmt.Sprintf(`W/"%x"`, h.Sum64())
+}
+
+// etagMatches 按 If-None-Match 的弱比较规则判断是否命中
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	want := strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestGeoETag(t *testing.T) {
+	a := GeoResponse{IP: "8.8.8.8", CountryCode: "US", Timestamp: 1, RequestID: "a"}
+	b := GeoResponse{IP: "8.8.8.8", CountryCode: "US", Timestamp: 2, RequestID: "b"}
+	if geoETag(a, "") != geoETag(b, "") {
+		t.Error("ETag should ignore timestamp and request_id")
+	}
+	if geoETag(a, "") == geoETag(a, "country_code") {
+		t.Error("ETag should depend on selected fields")
+	}
+
+	etag := geoETag(a, "")
+	testCases := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{etag, true},
+		{etag[2:], true},
+		{`"other", ` + etag, true},
+		{"*", true},
+		{`W/"other"`, false},
+	}
+	for _, tc := range testCases {
+		if got := etagMatches(tc.header, etag); got != tc.want {
+			t.Errorf("etagMatches(%q) = %v, want %v", tc.header, got, tc.want)
+		}
+	}
+}
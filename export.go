@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// countryDBPath 供需要遍历整个库的接口单独打开 maxminddb.Reader（geoip2.Reader 不暴露 Networks）
+var countryDBPath string
+
+// exportSlots 限制同时进行的导出、遍历与 /api/range 数量，三者都需要重新打开并遍历数据库，开销较大
+var exportSlots = make(chan struct{}, 1)
+
+const exportFlushEvery = 256
+
+type exportRow struct {
+	Network     string `json:"network"`
+	CountryCode string `json:"country_code"`
+}
+
+// exportHandler 遍历城市库，流式输出国家代码匹配的所有网段
+func exportHandler(c *gin.Context) {
+	country := strings.ToUpper(strings.TrimSpace(c.Query("country")))
+	if len(country) != 2 {
+		abortWithError(c, http.StatusBadRequest, ErrCodeInvalidParam, "country must be a two-letter ISO code")
+		return
+	}
+	format := c.DefaultQuery("format", "jsonl")
+	if format != "jsonl" && format != "csv" {
+		abortWithError(c, http.StatusBadRequest, ErrCodeInvalidParam, "format must be jsonl or csv")
+		return
+	}
+	dbMutex.RLock()
+	loaded := countryDB != nil
+	dbMutex.RUnlock()
+	if !loaded {
+		abortWithError(c, http.StatusServiceUnavailable, ErrCodeNoData, "City database not loaded")
+		return
+	}
+
+	select {
+	case exportSlots <- struct{}{}:
+		defer func() { <-exportSlots }()
+	default:
+		abortWithError(c, http.StatusTooManyRequests, ErrCodeRateLimited, "Another export is in progress")
+		return
+	}
+
+	reader, err := openRawMMDB(countryDBPath)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, ErrCodeLookupFailed, "Failed to open city database")
+		return
+	}
+	defer reader.Close()
+
+	clearWriteDeadline(c)
+	var write func(exportRow) error
+	var flush func()
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		w := csv.NewWriter(c.Writer)
+		w.Write([]string{"network", "country_code"})
+		write = func(row exportRow) error { return w.Write([]string{row.Network, row.CountryCode}) }
+		flush = func() { w.Flush(); c.Writer.Flush() }
+	} else {
+		c.Header("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(c.Writer)
+		write = func(row exportRow) error { return enc.Encode(row) }
+		flush = c.Writer.Flush
+	}
+	c.Status(http.StatusOK)
+
+	ctx := c.Request.Context()
+	rows := 0
+	for result := range reader.Networks() {
+		var record struct {
+			Country struct {
+				ISOCode string `maxminddb:"iso_code"`
+			} `maxminddb:"country"`
+		}
+		if err := result.Decode(&record); err != nil {
+			requestID, _ := c.Get("RequestID")
+			log.Printf("[%s] Export aborted: %v", requestID, err)
+			break
+		}
+		if record.Country.ISOCode != country {
+			continue
+		}
+		if err := write(exportRow{Network: result.Prefix().String(), CountryCode: country}); err != nil {
+			break
+		}
+		rows++
+		if rows%exportFlushEvery == 0 {
+			flush()
+			if ctx.Err() != nil {
+				// 客户端已断开
+				return
+			}
+		}
+	}
+	flush()
+}
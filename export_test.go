@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestExportHandler(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(requestIDMiddleware())
+	r.GET("/api/export", exportHandler)
+
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/export?"+query, nil)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := get("country=de"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("without database: status = %d, want 503", w.Code)
+	}
+
+	path := writeTestMMDB(t, "GeoLite2-City", map[string]any{
+		"5.1.0.0/16":   map[string]any{"country": map[string]any{"iso_code": "DE"}},
+		"5.3.0.0/16":   map[string]any{"country": map[string]any{"iso_code": "DE"}},
+		"8.8.8.0/24":   map[string]any{"country": map[string]any{"iso_code": "US"}},
+		"31.13.0.0/16": map[string]any{"country": map[string]any{"iso_code": "IE"}},
+	})
+	db, err := openMMDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	countryDB, countryDBPath = db, path
+	defer func() { countryDB, countryDBPath = nil, "" }()
+
+	w := get("country=de")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("jsonl: status = %d, Content-Type = %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	var networks []string
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var row exportRow
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			t.Fatalf("invalid line %q: %v", scanner.Text(), err)
+		}
+		if row.CountryCode != "DE" {
+			t.Errorf("row %+v has the wrong country", row)
+		}
+		networks = append(networks, row.Network)
+	}
+	if !slices.Equal(networks, []string{"5.1.0.0/16", "5.3.0.0/16"}) {
+		t.Errorf("jsonl networks = %v", networks)
+	}
+
+	w = get("country=US&format=csv")
+	if want := "network,country_code\n8.8.8.0/24,US\n"; w.Code != http.StatusOK || w.Body.String() != want {
+		t.Errorf("csv: status = %d, body = %q, want %q", w.Code, w.Body.String(), want)
+	}
+
+	for _, query := range []string{"country=DEU", "country=DE&format=xml"} {
+		if w := get(query); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, w.Code)
+		}
+	}
+
+	// 已有导出在进行时直接拒绝，不排队等待
+	exportSlots <- struct{}{}
+	w = get("country=DE")
+	<-exportSlots
+	if w.Code != http.StatusTooManyRequests || !strings.Contains(w.Body.String(), ErrCodeRateLimited) {
+		t.Errorf("concurrent export: status = %d, body = %s", w.Code, w.Body.String())
+	}
+}
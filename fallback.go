@@ -0,0 +1,89 @@
+package main
+
+import (
+	"log"
+	"net/netip"
+	"path/filepath"
+
+	"github.com/oschwald/geoip2-golang/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// fallbackDB 是按顺序查询的次级数据库：主库对某 IP 没有记录时依次尝试，
+// 取第一个有数据的结果。指针与主库一样由 dbMutex 保护并参与热加载
+type fallbackDB struct {
+	path string
+	db   *geoip2.Reader
+}
+
+var (
+	cityFallbacks []*fallbackDB
+	asnFallbacks  []*fallbackDB
+)
+
+// dbAnswers 统计各数据库文件实际给出结果的次数，只在缓存未命中时计数
+var dbAnswers = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "geoip_db_answers_total",
+	Help: "Database lookups that returned data, by record type and source file.",
+}, []string{"type", "source"})
+
+func dbSourceName(path string) string {
+	return filepath.Base(path)
+}
+
+func openFallbacks(paths []string) ([]*fallbackDB, error) {
+	var list []*fallbackDB
+	for _, path := range paths {
+		r, err := openMMDB(path)
+		if err != nil {
+			for _, fb := range list {
+				fb.db.Close()
+			}
+			return nil, err
+		}
+		log.Printf("Opened fallback mmdb %s", path)
+		list = append(list, &fallbackDB{path: path, db: r})
+	}
+	return list, nil
+}
+
+// lookupCityFallback 依次查询次级 city 库，并用查询过的记录网段收窄 network。
+// 调用方需持有 dbMutex 读锁
+func lookupCityFallback(ip netip.Addr, network *netip.Prefix) (*geoip2.City, *DataSource) {
+	for _, fb := range cityFallbacks {
+		if fb.db == nil {
+			continue
+		}
+		record, err := fb.db.City(ip)
+		if err != nil {
+			log.Printf("Fallback city lookup in %s failed for %s: %v", fb.path, ip, err)
+			continue
+		}
+		*network = narrowNetwork(*network, record.Traits.Network)
+		if record.HasData() {
+			return record, newDataSource(fb.path, fb.db)
+		}
+	}
+	return nil, nil
+}
+
+// lookupASNFallback 依次查询次级 ASN 库，并用查询过的记录网段收窄 network。
+// 调用方需持有 dbMutex 读锁
+func lookupASNFallback(ip netip.Addr, network *netip.Prefix) (*geoip2.ASN, *DataSource) {
+	for _, fb := range asnFallbacks {
+		if fb.db == nil {
+			continue
+		}
+		record, err := fb.db.ASN(ip)
+		if err != nil {
+			log.Printf("Fallback ASN lookup in %s failed for %s: %v", fb.path, ip, err)
+			continue
+		}
+		*network = narrowNetwork(*network, record.Network)
+		if record.HasData() {
+			return record, newDataSource(fb.path, fb.db)
+		}
+	}
+	return nil, nil
+}
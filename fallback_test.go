@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestLookupFallbacks(t *testing.T) {
+	primary := writeTestMMDB(t, "GeoLite2-City", map[string]any{
+		"1.1.1.0/24": map[string]any{"country": map[string]any{"iso_code": "AU"}},
+	})
+	secondary := writeTestMMDB(t, "GeoLite2-Country", map[string]any{
+		"1.1.1.0/24": map[string]any{"country": map[string]any{"iso_code": "US"}},
+		"8.8.8.0/24": map[string]any{"country": map[string]any{"iso_code": "US"}},
+	})
+	asnPrimary := writeTestMMDB(t, "GeoLite2-ASN", map[string]any{
+		"1.1.1.0/24": map[string]any{"autonomous_system_number": uint32(13335), "autonomous_system_organization": "CLOUDFLARENET"},
+	})
+	asnSecondary := writeTestMMDB(t, "GeoIP2-ISP", map[string]any{
+		"8.8.8.0/24": map[string]any{"autonomous_system_number": uint32(15169), "autonomous_system_organization": "GOOGLE"},
+	})
+
+	var err error
+	if countryDB, err = openMMDB(primary); err != nil {
+		t.Fatal(err)
+	}
+	if asnDB, err = openMMDB(asnPrimary); err != nil {
+		t.Fatal(err)
+	}
+	if cityFallbacks, err = openFallbacks([]string{secondary}); err != nil {
+		t.Fatal(err)
+	}
+	if asnFallbacks, err = openFallbacks([]string{asnSecondary}); err != nil {
+		t.Fatal(err)
+	}
+	countryDBPath, asnDBPath = primary, asnPrimary
+	defer func() {
+		countryDB.Close()
+		asnDB.Close()
+		cityFallbacks[0].db.Close()
+		asnFallbacks[0].db.Close()
+		countryDB, asnDB, cityFallbacks, asnFallbacks = nil, nil, nil, nil
+		countryDBPath, asnDBPath = "", ""
+	}()
+
+	// 主库有记录时不查询次级库
+	entry, err := lookupDatabases(netip.MustParseAddr("1.1.1.1"), lookupOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.country.Country.ISOCode != "AU" || entry.countrySource.Database != "GeoLite2-City.mmdb" {
+		t.Errorf("1.1.1.1 country = %q from %+v", entry.country.Country.ISOCode, entry.countrySource)
+	}
+	if entry.asn.AutonomousSystemNumber != 13335 || entry.asnSource.Database != "GeoLite2-ASN.mmdb" {
+		t.Errorf("1.1.1.1 asn = %d from %+v", entry.asn.AutonomousSystemNumber, entry.asnSource)
+	}
+
+	// 主库没有记录时由次级库给出，并在 sources 中报告实际来源
+	ip := netip.MustParseAddr("8.8.8.8")
+	entry, err = lookupDatabases(ip, lookupOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := newGeoResponse(ip, entry)
+	if res.CountryCode != "US" || res.ASN != 15169 || res.Organization != "GOOGLE" {
+		t.Errorf("8.8.8.8 = %+v", res)
+	}
+	if res.Sources == nil || res.Sources.Country.Database != "GeoLite2-Country.mmdb" || res.Sources.ASN.Database != "GeoIP2-ISP.mmdb" {
+		t.Errorf("8.8.8.8 sources = %+v", res.Sources)
+	}
+	if entry.network.String() != "8.8.8.0/24" {
+		t.Errorf("8.8.8.8 network = %s", entry.network)
+	}
+
+	// 所有库都没有记录
+	entry, err = lookupDatabases(netip.MustParseAddr("9.9.9.9"), lookupOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.countrySource != nil || entry.asnSource != nil || entry.country.HasData() {
+		t.Errorf("9.9.9.9 = %+v", entry)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// defaultFields 为 -fields 指定的服务端默认字段集合，请求中的 ?fields= 优先
+var defaultFields string
+
+// geoResponseFields 为 GeoResponse 的 JSON 字段名 → 结构体字段下标
+var geoResponseFields = jsonFieldIndex(reflect.TypeOf(GeoResponse{}))
+
+// geoResponseFieldNames 为按结构体顺序排列的可选字段名，用于错误提示
+var geoResponseFieldNames = jsonFieldNames(reflect.TypeOf(GeoResponse{}))
+
+// geoResponseOmitEmpty 为带 omitempty 的结构体字段下标
+var geoResponseOmitEmpty = jsonOmitEmpty(reflect.TypeOf(GeoResponse{}))
+
+// fieldRenames 为 -field-names 加载的 JSON 字段名 → 输出字段名，为 nil 时按结构体标签输出
+var fieldRenames map[string]string
+
+func jsonFieldIndex(t reflect.Type) map[string]int {
+	index := make(map[string]int, t.NumField())
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			index[name] = i
+		}
+	}
+	return index
+}
+
+func jsonFieldNames(t reflect.Type) []string {
+	names := make([]string, 0, t.NumField())
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func jsonOmitEmpty(t reflect.Type) map[int]bool {
+	omit := make(map[int]bool)
+	for i := range t.NumField() {
+		_, opts, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if strings.Contains(","+opts+",", ",omitempty,") {
+			omit[i] = true
+		}
+	}
+	return omit
+}
+
+func unknownFieldsMessage(unknown []string) string {
+	return fmt.Sprintf("fields: unknown field(s) %s; acceptable values: %s",
+		strings.Join(unknown, ","), strings.Join(geoResponseFieldNames, ","))
+}
+
+// parseFields 解析逗号分隔的字段列表，返回有效字段与未知字段
+func parseFields(param string) (fields, unknown []string) {
+	for _, name := range strings.Split(param, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := geoResponseFields[name]; ok {
+			fields = append(fields, name)
+		} else {
+			unknown = append(unknown, name)
+		}
+	}
+	return fields, unknown
+}
+
+// responseBody 返回实际序列化的响应：指定了 fields 时裁剪，配置了 -field-names 时
+// 经 map 改名输出（键按字母序排列），否则原样返回结构体
+func responseBody(res *GeoResponse, fields []string) any {
+	if len(fields) > 0 {
+		return outputFields(res, fields)
+	}
+	if fieldRenames == nil {
+		return *res
+	}
+	return outputFields(res, geoResponseFieldNames)
+}
+
+// outputFields 把 names 对应的字段放入 map，与结构体序列化一致：带 omitempty 的字段为零值时省略，
+// is_private 等不带 omitempty 的字段即使为 false 也输出；裁剪与改名都经过这里，同一记录的输出键保持一致
+func outputFields(res *GeoResponse, names []string) map[string]any {
+	v := reflect.ValueOf(res).Elem()
+	out := make(map[string]any, len(names))
+	for _, name := range names {
+		i := geoResponseFields[name]
+		if f := v.Field(i); !f.IsZero() || !geoResponseOmitEmpty[i] {
+			out[outputFieldName(name)] = f.Interface()
+		}
+	}
+	return out
+}
+
+func outputFieldName(name string) string {
+	if renamed, ok := fieldRenames[name]; ok {
+		return renamed
+	}
+	return name
+}
+
+// loadFieldNames 读取每行一条 原字段名=新字段名 的映射文件，# 之后为注释。
+// 原字段名必须是 GeoResponse 的 JSON 字段，改名后不能与其他输出字段重名
+func loadFieldNames(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	renames := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		if text = strings.TrimSpace(text); text == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(text, "=")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if !ok || from == "" || to == "" {
+			return nil, fmt.Errorf("line %d: want field=name, got %q", line, text)
+		}
+		if _, known := geoResponseFields[from]; !known {
+			return nil, fmt.Errorf("line %d: unknown field %q", line, from)
+		}
+		if _, dup := renames[from]; dup {
+			return nil, fmt.Errorf("line %d: field %q mapped twice", line, from)
+		}
+		renames[from] = to
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]string, len(geoResponseFieldNames))
+	for _, name := range geoResponseFieldNames {
+		out := name
+		if renamed, ok := renames[name]; ok {
+			out = renamed
+		}
+		if prev, ok := seen[out]; ok {
+			return nil, fmt.Errorf("fields %q and %q both output as %q", prev, name, out)
+		}
+		seen[out] = name
+	}
+	return renames, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOutputFields(t *testing.T) {
+	fields, unknown := parseFields("country_code, asn,bogus,,city")
+	if !reflect.DeepEqual(fields, []string{"country_code", "asn", "city"}) {
+		t.Errorf("fields = %v", fields)
+	}
+	if !reflect.DeepEqual(unknown, []string{"bogus"}) {
+		t.Errorf("unknown = %v", unknown)
+	}
+
+	res := &GeoResponse{CountryCode: "US", ASN: 15169, Country: "United States"}
+	got := outputFields(res, fields)
+	want := map[string]any{"country_code": "US", "asn": uint(15169)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("outputFields = %v, want %v", got, want)
+	}
+
+	// 不带 omitempty 的布尔字段为 false 时仍然返回
+	res = &GeoResponse{IP: "8.8.8.8", IsGlobal: true}
+	got = outputFields(res, []string{"ip", "is_private", "is_global", "city"})
+	want = map[string]any{"ip": "8.8.8.8", "is_private": false, "is_global": true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("outputFields with false bool = %v, want %v", got, want)
+	}
+}
+
+func TestGeoHandlerRejectsUnknownFields(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(requestIDMiddleware())
+	r.GET("/api/ipinfo", geoHandler)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/ipinfo?ip=8.8.8.8&fields=country_code,bogus", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+	var res ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Code != ErrCodeInvalidParam || !strings.Contains(res.Message, "fields") || !strings.Contains(res.Message, "bogus") {
+		t.Errorf("unexpected error response: %+v", res)
+	}
+}
+
+func TestFieldRenames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "names.txt")
+	os.WriteFile(path, []byte("# 下游固定字段名\ncountry_code = cc\norganization=org\n"), 0o644)
+	renames, err := loadFieldNames(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fieldRenames = renames
+	defer func() { fieldRenames = nil }()
+
+	res := &GeoResponse{IP: "8.8.8.8", CountryCode: "US", Organization: "GOOGLE"}
+	b, _ := json.Marshal(responseBody(res, nil))
+	want := `{"cc":"US","ip":"8.8.8.8","is_global":false,"is_loopback":false,"is_private":false,"is_reserved":false,"org":"GOOGLE"}`
+	if string(b) != want {
+		t.Errorf("renamed body = %s, want %s", b, want)
+	}
+	if got := responseBody(res, []string{"country_code"}); !reflect.DeepEqual(got, map[string]any{"cc": "US"}) {
+		t.Errorf("responseBody with renames = %v", got)
+	}
+	// ?fields= 与完整响应对同一记录输出相同的键
+	if got := responseBody(res, []string{"country_code", "is_private", "city"}); !reflect.DeepEqual(got, map[string]any{"cc": "US", "is_private": false}) {
+		t.Errorf("responseBody with renames and fields = %v", got)
+	}
+
+	for name, content := range map[string]string{
+		"Unknown":   "bogus=b\n",
+		"Collision": "country_code=country\n",
+		"Malformed": "country_code\n",
+	} {
+		os.WriteFile(path, []byte(content), 0o644)
+		if _, err := loadFieldNames(path); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import "github.com/oschwald/geoip2-golang/v2"
+
+type geoJSONPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+// geoJSONFeature 为 ?geojson=true 的响应，properties 为普通响应内容（受 fields 影响）
+type geoJSONFeature struct {
+	Type       string       `json:"type"`
+	Geometry   geoJSONPoint `json:"geometry"`
+	Properties any          `json:"properties"`
+}
+
+// newGeoJSONFeature 按 GeoJSON 约定以 [经度, 纬度] 顺序构造 Point，库中没有坐标时返回 false
+func newGeoJSONFeature(loc geoip2.Location, properties any) (geoJSONFeature, bool) {
+	if loc.Latitude == nil || loc.Longitude == nil {
+		return geoJSONFeature{}, false
+	}
+	return geoJSONFeature{
+		Type: "Feature",
+		Geometry: geoJSONPoint{
+			Type:        "Point",
+			Coordinates: [2]float64{*loc.Longitude, *loc.Latitude},
+		},
+		Properties: properties,
+	}, true
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/oschwald/geoip2-golang/v2"
+)
+
+func TestNewGeoJSONFeature(t *testing.T) {
+	lat, lon := 35.69, 139.69
+	feature, ok := newGeoJSONFeature(geoip2.Location{Latitude: &lat, Longitude: &lon}, map[string]any{"country_code": "JP"})
+	if !ok {
+		t.Fatal("expected feature")
+	}
+	data, _ := json.Marshal(feature)
+	want := `{"type":"Feature","geometry":{"type":"Point","coordinates":[139.69,35.69]},"properties":{"country_code":"JP"}}`
+	if string(data) != want {
+		t.Errorf("got %s\nwant %s", data, want)
+	}
+
+	if _, ok := newGeoJSONFeature(geoip2.Location{Latitude: &lat}, nil); ok {
+		t.Error("missing longitude should not produce a feature")
+	}
+}
+
+func TestGeoHandlerGeoJSONErrors(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(requestIDMiddleware())
+	r.GET("/api/ipinfo", geoHandler)
+
+	for query, want := range map[string]int{
+		"?ip=127.0.0.1&geojson=yes":              http.StatusBadRequest,
+		"?ip=127.0.0.1&geojson=1&callback=onGeo": http.StatusBadRequest,
+		"?ip=127.0.0.1&geojson=true":             http.StatusNotFound,
+		"?ip=127.0.0.1&geojson=false":            http.StatusOK,
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/ipinfo"+query, nil)
+		r.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("%s: status = %d, want %d", query, w.Code, want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errDBUnavailable 表示处于仅缓存模式（数据库熔断或正在热加载）且缓存未命中
+var errDBUnavailable = errors.New("database unavailable, serving from cache only")
+
+var (
+	// breakerThreshold 为连续查询错误次数阈值，达到后将数据库标记为不健康，0 表示关闭熔断
+	breakerThreshold int64 = 5
+	// breakerCacheOnly 为 true 时，数据库不健康期间只从缓存返回结果，未命中返回 503
+	breakerCacheOnly bool
+	// reloadCacheOnly 为 true 时，热加载数据库期间只从缓存返回结果，未命中返回 503
+	reloadCacheOnly bool
+	// reloading 在 reloadDatabases 执行期间为 true
+	reloading atomic.Bool
+
+	countryHealth = dbHealth{name: "city"}
+	asnHealth     = dbHealth{name: "ASN"}
+)
+
+// dbHealth 记录单个数据库的连续错误次数，熔断后直到成功热加载才恢复
+type dbHealth struct {
+	name      string
+	failures  atomic.Int64
+	unhealthy atomic.Bool
+}
+
+func (h *dbHealth) observe(err error) {
+	if err == nil {
+		h.failures.Store(0)
+		return
+	}
+	if breakerThreshold > 0 && h.failures.Add(1) >= breakerThreshold && !h.unhealthy.Swap(true) {
+		log.Printf("WARNING: %s mmdb marked unhealthy after %d consecutive errors: %v", h.name, breakerThreshold, err)
+	}
+}
+
+func (h *dbHealth) reset() {
+	h.failures.Store(0)
+	if h.unhealthy.Swap(false) {
+		log.Printf("%s mmdb marked healthy after reload", h.name)
+	}
+}
+
+func (h *dbHealth) status(loaded bool) string {
+	switch {
+	case !loaded:
+		return "missing"
+	case h.unhealthy.Load():
+		return "unhealthy"
+	default:
+		return "ok"
+	}
+}
+
+// cacheOnly 判断缓存未命中时是否直接返回 errDBUnavailable 而不查询数据库
+func cacheOnly() bool {
+	if breakerCacheOnly && (countryHealth.unhealthy.Load() || asnHealth.unhealthy.Load()) {
+		return true
+	}
+	return reloadCacheOnly && reloading.Load()
+}
+
+func healthzHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// readyzHandler 任一已加载的数据库被熔断，或开启 -reload-cache-only 且正在热加载时返回 503
+func readyzHandler(c *gin.Context) {
+	dbMutex.RLock()
+	databases := gin.H{
+		"city": countryHealth.status(countryDB != nil),
+		"asn":  asnHealth.status(asnDB != nil),
+	}
+	dbMutex.RUnlock()
+
+	status, code := "ok", http.StatusOK
+	for _, s := range databases {
+		if s == "unhealthy" {
+			status, code = "unavailable", http.StatusServiceUnavailable
+		}
+	}
+	isReloading := reloading.Load()
+	if code == http.StatusOK && reloadCacheOnly && isReloading {
+		status, code = "reloading", http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{"status": status, "databases": databases, "reloading": isReloading})
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDBHealthBreaker(t *testing.T) {
+	h := dbHealth{name: "test"}
+	errRead := errors.New("read error")
+
+	for range breakerThreshold - 1 {
+		h.observe(errRead)
+	}
+	h.observe(nil)
+	for range breakerThreshold - 1 {
+		h.observe(errRead)
+	}
+	if h.unhealthy.Load() {
+		t.Fatal("non-consecutive errors should not trip the breaker")
+	}
+
+	h.observe(errRead)
+	if !h.unhealthy.Load() {
+		t.Fatal("breaker should trip after consecutive errors")
+	}
+	h.observe(nil)
+	if !h.unhealthy.Load() {
+		t.Fatal("breaker should stay open until reload")
+	}
+
+	h.reset()
+	if h.unhealthy.Load() || h.failures.Load() != 0 {
+		t.Fatal("reset should restore health")
+	}
+}
+
+func TestReloadCacheOnly(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	defer func() {
+		reloadCacheOnly = false
+		reloading.Store(false)
+	}()
+
+	reloading.Store(true)
+	if cacheOnly() {
+		t.Fatal("reloading should not force cache-only unless -reload-cache-only is set")
+	}
+	reloadCacheOnly = true
+	if !cacheOnly() {
+		t.Fatal("expected cache-only while reloading")
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	readyzHandler(c)
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), `"reloading":true`) {
+		t.Errorf("readyz during reload = %d %s", w.Code, w.Body.String())
+	}
+
+	reloading.Store(false)
+	if cacheOnly() {
+		t.Error("cache-only should end with the reload")
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// hostingASNs 为 -hosting-asns 加载的机房/云厂商 ASN 集合，随 SIGHUP 热加载
+var hostingASNs atomic.Pointer[map[uint]struct{}]
+
+// loadHostingASNs 读取每行一个 ASN 的文件（可带 AS 前缀），# 之后为注释
+func loadHostingASNs(path string) (map[uint]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	set := make(map[uint]struct{})
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		if text = strings.TrimSpace(text); text == "" {
+			continue
+		}
+		asn, err := parseASN(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid ASN %q", line, text)
+		}
+		set[asn] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+func reloadHostingASNs(path string) (int, error) {
+	set, err := loadHostingASNs(path)
+	if err != nil {
+		return 0, err
+	}
+	hostingASNs.Store(&set)
+	return len(set), nil
+}
+
+// isHostingASN 为启发式判断：ASN 在列表中不代表该 IP 一定是机房流量，反之亦然
+func isHostingASN(asn uint) bool {
+	set := hostingASNs.Load()
+	if set == nil || asn == 0 {
+		return false
+	}
+	_, ok := (*set)[asn]
+	return ok
+}
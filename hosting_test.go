@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHostingASNs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosting.txt")
+	content := "# cloud providers\n16509\nAS15169 # Google\n\n  14061\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := reloadHostingASNs(path)
+	if err != nil || n != 3 {
+		t.Fatalf("reloadHostingASNs = %d, %v", n, err)
+	}
+	defer hostingASNs.Store(nil)
+
+	for asn, want := range map[uint]bool{16509: true, 15169: true, 14061: true, 4134: false, 0: false} {
+		if got := isHostingASN(asn); got != want {
+			t.Errorf("isHostingASN(%d) = %v, want %v", asn, got, want)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("16509\nbogus\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reloadHostingASNs(path); err == nil {
+		t.Error("expected error for invalid line")
+	}
+	// 加载失败保留旧列表
+	if !isHostingASN(15169) {
+		t.Error("previous list should be kept after a failed reload")
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// rangeMinBits、rangeMinBits6 为 /api/range 接受的最短 IPv4/IPv6 前缀长度（-range-min-prefix / -range-min-prefix6），
+	// 更大的网段遍历开销过高
+	rangeMinBits  = 16
+	rangeMinBits6 = 32
+)
+
+type rangeCountry struct {
+	CountryCode string `json:"country_code"`
+	Networks    int    `json:"networks"`
+}
+
+type rangeASN struct {
+	ASN          uint   `json:"asn"`
+	Organization string `json:"organization,omitempty"`
+	Networks     int    `json:"networks"`
+}
+
+type RangeResponse struct {
+	CIDR      string         `json:"cidr"`
+	Countries []rangeCountry `json:"countries"`
+	ASNs      []rangeASN     `json:"asns"`
+	RequestID string         `json:"request_id,omitempty"`
+}
+
+// parseRangeCIDR 解析并规整 cidr，拒绝超过 -range-min-prefix 的网段
+func parseRangeCIDR(s string) (netip.Prefix, error) {
+	p, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, errors.New("cidr: must be a CIDR prefix such as 203.0.113.0/24")
+	}
+	p = p.Masked()
+	if minBits := rangeMinBits; p.Addr().Is4() && p.Bits() < minBits {
+		return netip.Prefix{}, fmt.Errorf("cidr: IPv4 prefixes must be /%d or longer", minBits)
+	}
+	if minBits := rangeMinBits6; p.Addr().Is6() && p.Bits() < minBits {
+		return netip.Prefix{}, fmt.Errorf("cidr: IPv6 prefixes must be /%d or longer", minBits)
+	}
+	return p, nil
+}
+
+// walkRangeCountries 统计 prefix 内各国家的网段数，没有国家信息的记录不计入
+func walkRangeCountries(path string, prefix netip.Prefix) ([]rangeCountry, error) {
+	reader, err := openRawMMDB(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	counts := make(map[string]int)
+	for result := range reader.NetworksWithin(prefix) {
+		var record walkRecord
+		if err := result.Decode(&record); err != nil {
+			return nil, err
+		}
+		if record.Country.ISOCode != "" {
+			counts[record.Country.ISOCode]++
+		}
+	}
+	res := make([]rangeCountry, 0, len(counts))
+	for code, n := range counts {
+		res = append(res, rangeCountry{CountryCode: code, Networks: n})
+	}
+	slices.SortFunc(res, func(a, b rangeCountry) int {
+		return cmp.Or(cmp.Compare(b.Networks, a.Networks), cmp.Compare(a.CountryCode, b.CountryCode))
+	})
+	return res, nil
+}
+
+// walkRangeASNs 统计 prefix 内各 ASN 的网段数
+func walkRangeASNs(path string, prefix netip.Prefix) ([]rangeASN, error) {
+	reader, err := openRawMMDB(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	byASN := make(map[uint]*rangeASN)
+	for result := range reader.NetworksWithin(prefix) {
+		var record walkRecord
+		if err := result.Decode(&record); err != nil {
+			return nil, err
+		}
+		if record.ASN == 0 {
+			continue
+		}
+		a, ok := byASN[record.ASN]
+		if !ok {
+			a = &rangeASN{ASN: record.ASN, Organization: record.Organization}
+			byASN[record.ASN] = a
+		}
+		a.Networks++
+	}
+	res := make([]rangeASN, 0, len(byASN))
+	for _, a := range byASN {
+		res = append(res, *a)
+	}
+	slices.SortFunc(res, func(a, b rangeASN) int {
+		return cmp.Or(cmp.Compare(b.Networks, a.Networks), cmp.Compare(a.ASN, b.ASN))
+	})
+	return res, nil
+}
+
+// rangeHandler 遍历 cidr 内的记录，返回其中出现的国家与 ASN 及各自的网段数，用于判断网段是否单一归属。
+// 网段数为 mmdb 中的记录数，并非地址数；直接读取数据库文件，不经过缓存与覆盖规则
+func rangeHandler(c *gin.Context) {
+	prefix, err := parseRangeCIDR(c.Query("cidr"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, ErrCodeInvalidParam, err.Error())
+		return
+	}
+
+	dbMutex.RLock()
+	cityPath, asnPath := countryDBPath, asnDBPath
+	if countryDB == nil {
+		cityPath = ""
+	}
+	if asnDB == nil {
+		asnPath = ""
+	}
+	dbMutex.RUnlock()
+	if cityPath == "" && asnPath == "" {
+		abortWithError(c, http.StatusServiceUnavailable, ErrCodeNoData, "Database not loaded")
+		return
+	}
+
+	// 该接口无需鉴权，每次请求都要重新打开数据库文件（.gz 会整个解压到内存），
+	// 与导出、遍历共用并发限制，没有空闲名额时直接返回 503 而不排队
+	select {
+	case exportSlots <- struct{}{}:
+		defer func() { <-exportSlots }()
+	default:
+		abortWithError(c, http.StatusServiceUnavailable, ErrCodeOverloaded, "Another database walk is in progress")
+		return
+	}
+
+	requestID, _ := c.Get("RequestID")
+	id, _ := requestID.(string)
+	res := RangeResponse{CIDR: prefix.String(), Countries: []rangeCountry{}, ASNs: []rangeASN{}, RequestID: id}
+	if cityPath != "" {
+		if res.Countries, err = walkRangeCountries(cityPath, prefix); err != nil {
+			abortWithError(c, http.StatusInternalServerError, ErrCodeLookupFailed, "Failed to walk city database")
+			return
+		}
+	}
+	if asnPath != "" {
+		if res.ASNs, err = walkRangeASNs(asnPath, prefix); err != nil {
+			abortWithError(c, http.StatusInternalServerError, ErrCodeLookupFailed, "Failed to walk ASN database")
+			return
+		}
+	}
+	c.JSON(http.StatusOK, res)
+}
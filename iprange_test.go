@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseRangeCIDR(t *testing.T) {
+	for _, tc := range []struct {
+		cidr string
+		want string
+	}{
+		{"203.0.113.77/24", "203.0.113.0/24"},
+		{"10.1.0.0/16", "10.1.0.0/16"},
+		{"10.0.0.0/8", ""},
+		{"2001:db8::/32", "2001:db8::/32"},
+		{"2001::/16", ""},
+		{"203.0.113.7", ""},
+	} {
+		p, err := parseRangeCIDR(tc.cidr)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("parseRangeCIDR(%q) = %v, want error", tc.cidr, p)
+			}
+			continue
+		}
+		if err != nil || p.String() != tc.want {
+			t.Errorf("parseRangeCIDR(%q) = %v, %v, want %s", tc.cidr, p, err, tc.want)
+		}
+	}
+}
+
+func TestRangeHandlerNoDatabase(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.GET("/api/range", rangeHandler)
+
+	for url, want := range map[string]int{
+		"/api/range?cidr=10.0.0.0/8":  http.StatusBadRequest,
+		"/api/range?cidr=10.1.0.0/16": http.StatusServiceUnavailable,
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != want {
+			t.Errorf("%s: status = %d, want %d", url, w.Code, want)
+		}
+	}
+}
+
+func TestRangeHandler(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(requestIDMiddleware())
+	r.GET("/api/range", rangeHandler)
+
+	cityPath := writeTestMMDB(t, "GeoLite2-City", map[string]any{
+		"203.0.112.0/24":  map[string]any{"country": map[string]any{"iso_code": "NZ"}},
+		"203.0.113.0/25":  map[string]any{"country": map[string]any{"iso_code": "AU"}},
+		"203.0.114.0/24":  map[string]any{"country": map[string]any{"iso_code": "AU"}},
+		"203.0.115.0/24":  map[string]any{"country": map[string]any{"iso_code": "JP"}},
+		"203.0.116.0/24":  map[string]any{"city": map[string]any{"names": map[string]any{"en": "Nowhere"}}},
+		"198.51.100.0/24": map[string]any{"country": map[string]any{"iso_code": "US"}}, // cidr 之外
+	})
+	asnPath := writeTestMMDB(t, "GeoLite2-ASN", map[string]any{
+		"203.0.112.0/24":  map[string]any{"autonomous_system_number": uint32(64510), "autonomous_system_organization": "Example B"},
+		"203.0.113.0/25":  map[string]any{"autonomous_system_number": uint32(64500), "autonomous_system_organization": "Example A"},
+		"203.0.114.0/24":  map[string]any{"autonomous_system_number": uint32(64500), "autonomous_system_organization": "Example A"},
+		"203.0.115.0/24":  map[string]any{"autonomous_system_number": uint32(64501), "autonomous_system_organization": "Example C"},
+		"198.51.100.0/24": map[string]any{"autonomous_system_number": uint32(64499), "autonomous_system_organization": "Outside"},
+	})
+	var err error
+	if countryDB, err = openMMDB(cityPath); err != nil {
+		t.Fatal(err)
+	}
+	if asnDB, err = openMMDB(asnPath); err != nil {
+		t.Fatal(err)
+	}
+	countryDBPath, asnDBPath = cityPath, asnPath
+	defer func() {
+		countryDB.Close()
+		asnDB.Close()
+		countryDB, asnDB = nil, nil
+		countryDBPath, asnDBPath = "", ""
+	}()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/range?cidr=203.0.112.0/20", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var res RangeResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	// 按网段数从多到少排列，相同时按国家代码 / ASN 升序；没有国家或 ASN 的记录不计入
+	wantCountries := []rangeCountry{{"AU", 2}, {"JP", 1}, {"NZ", 1}}
+	if !reflect.DeepEqual(res.Countries, wantCountries) {
+		t.Errorf("countries = %+v, want %+v", res.Countries, wantCountries)
+	}
+	wantASNs := []rangeASN{{64500, "Example A", 2}, {64501, "Example C", 1}, {64510, "Example B", 1}}
+	if !reflect.DeepEqual(res.ASNs, wantASNs) {
+		t.Errorf("asns = %+v, want %+v", res.ASNs, wantASNs)
+	}
+	if res.CIDR != "203.0.112.0/20" || res.RequestID == "" {
+		t.Errorf("response = %+v", res)
+	}
+
+	// 已有遍历进行时不排队，直接返回 503
+	exportSlots <- struct{}{}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/range?cidr=203.0.112.0/20", nil))
+	<-exportSlots
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), ErrCodeOverloaded) {
+		t.Errorf("concurrent walk: status = %d, body = %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/netip"
+	"slices"
+)
+
+// ipv6PrefixLens 记录缓存中出现过的 IPv6 网段长度（从长到短），由 cacheMutex 保护。
+// IPv6 记录以网段为 key 缓存，查询时按这些长度截取地址即可命中同网段的其他地址
+var ipv6PrefixLens []int
+
+// aggregateIPv6 判断是否按网段聚合缓存该地址，IPv4 及 IPv4-mapped 地址仍按单个 IP 缓存
+func aggregateIPv6(ip netip.Addr) bool {
+	return ip.Is6() && !ip.Is4In6()
+}
+
+// narrowNetwork 返回两个都包含查询地址的网段的交集，即更长的那个。
+// 交集内所有地址在各数据库中命中的记录都相同，可共用一条缓存
+func narrowNetwork(cur, p netip.Prefix) netip.Prefix {
+	if !p.IsValid() {
+		return cur
+	}
+	if !cur.IsValid() || p.Bits() > cur.Bits() {
+		return p
+	}
+	return cur
+}
+
+// cacheKey 返回记录写入缓存时使用的 key，调用方需持有 cacheMutex
+func cacheKey(ip netip.Addr, entry *geoCacheEntry) any {
+	if !aggregateIPv6(ip) || !entry.network.IsValid() {
+		return ip.String()
+	}
+	bits := entry.network.Bits()
+	if i, found := slices.BinarySearchFunc(ipv6PrefixLens, bits, func(a, b int) int { return b - a }); !found {
+		ipv6PrefixLens = slices.Insert(ipv6PrefixLens, i, bits)
+	}
+	return entry.network
+}
+
+// cacheGetIPv6 依次按已知网段长度查找包含该地址的缓存，调用方需持有 cacheMutex
+func cacheGetIPv6(ip netip.Addr) (*geoCacheEntry, bool) {
+	for _, bits := range ipv6PrefixLens {
+		p, err := ip.Prefix(bits)
+		if err != nil {
+			continue
+		}
+		if v, ok := geoCache.Get(p); ok {
+			return v.(*geoCacheEntry), true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestIPv6PrefixCache(t *testing.T) {
+	oldCache, oldLens := geoCache, ipv6PrefixLens
+	defer func() { geoCache, ipv6PrefixLens = oldCache, oldLens }()
+	geoCache, ipv6PrefixLens = newGeoCache(100), nil
+
+	add := func(ip string, network string) *geoCacheEntry {
+		entry := &geoCacheEntry{network: netip.MustParsePrefix(network)}
+		cacheMutex.Lock()
+		geoCache.Add(cacheKey(netip.MustParseAddr(ip), entry), entry)
+		cacheMutex.Unlock()
+		return entry
+	}
+	wide := add("2001:db8::1", "2001:db8::/32")
+	narrow := add("2001:db9:1:2::1", "2001:db9:1:2::/64")
+	v4 := add("192.0.2.1", "192.0.2.0/24")
+
+	if len(ipv6PrefixLens) != 2 || ipv6PrefixLens[0] != 64 || ipv6PrefixLens[1] != 32 {
+		t.Fatalf("ipv6PrefixLens = %v, want [64 32]", ipv6PrefixLens)
+	}
+
+	testCases := []struct {
+		ip   string
+		want *geoCacheEntry
+	}{
+		{"2001:db8:ffff::1", wide},
+		{"2001:db9:1:2:abcd::1", narrow},
+		{"2001:db9:1:3::1", nil},
+		{"192.0.2.1", v4},
+		// IPv4 仍按单个地址缓存
+		{"192.0.2.2", nil},
+	}
+	for _, tc := range testCases {
+		got, ok := cacheGet(netip.MustParseAddr(tc.ip))
+		if ok != (tc.want != nil) || got != tc.want {
+			t.Errorf("cacheGet(%s) = %p, %v, want %p", tc.ip, got, ok, tc.want)
+		}
+	}
+}
+
+func TestNarrowNetwork(t *testing.T) {
+	wide := netip.MustParsePrefix("2001:db8::/32")
+	narrow := netip.MustParsePrefix("2001:db8:1::/48")
+	if got := narrowNetwork(wide, narrow); got != narrow {
+		t.Errorf("narrowNetwork(wide, narrow) = %v", got)
+	}
+	if got := narrowNetwork(narrow, wide); got != narrow {
+		t.Errorf("narrowNetwork(narrow, wide) = %v", got)
+	}
+	if got := narrowNetwork(netip.Prefix{}, wide); got != wide {
+		t.Errorf("narrowNetwork(invalid, wide) = %v", got)
+	}
+	if got := narrowNetwork(wide, netip.Prefix{}); got != wide {
+		t.Errorf("narrowNetwork(wide, invalid) = %v", got)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/netip"
+
+	"github.com/oschwald/geoip2-golang/v2"
+)
+
+var (
+	// ispDB 为 -isp-mmdb 指定的 GeoIP2-ISP 或 Enterprise 库，可选
+	ispDB           *geoip2.Reader
+	ispDBEnterprise bool
+)
+
+type ispInfo struct {
+	isp            string
+	organization   string
+	connectionType string
+	// 移动运营商的 MCC/MNC，ISP 与 Enterprise 库都提供
+	mobileCountryCode string
+	mobileNetworkCode string
+}
+
+// connectionTypeCellular 为 Enterprise 库中移动网络的 connection_type
+const connectionTypeCellular = "Cellular"
+
+// isMobile 判断是否来自移动运营商：接入类型为蜂窝网络，或记录带有移动网络代码
+func (i *ispInfo) isMobile() bool {
+	return i.connectionType == connectionTypeCellular || i.mobileCountryCode != "" || i.mobileNetworkCode != ""
+}
+
+// lookupISP 查询 ISP 信息，并用命中记录的网段收窄 network
+func lookupISP(ip netip.Addr, network *netip.Prefix) (*ispInfo, error) {
+	var info ispInfo
+	if ispDBEnterprise {
+		e, err := ispDB.Enterprise(ip)
+		if err != nil {
+			return nil, err
+		}
+		*network = narrowNetwork(*network, e.Traits.Network)
+		info = ispInfo{
+			isp:               e.Traits.ISP,
+			organization:      e.Traits.Organization,
+			connectionType:    e.Traits.ConnectionType,
+			mobileCountryCode: e.Traits.MobileCountryCode,
+			mobileNetworkCode: e.Traits.MobileNetworkCode,
+		}
+	} else {
+		r, err := ispDB.ISP(ip)
+		if err != nil {
+			return nil, err
+		}
+		*network = narrowNetwork(*network, r.Network)
+		info = ispInfo{
+			isp:               r.ISP,
+			organization:      r.Organization,
+			mobileCountryCode: r.MobileCountryCode,
+			mobileNetworkCode: r.MobileNetworkCode,
+		}
+	}
+	if info == (ispInfo{}) {
+		return nil, nil
+	}
+	return &info, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestISPInfoIsMobile(t *testing.T) {
+	for _, tc := range []struct {
+		info ispInfo
+		want bool
+	}{
+		{ispInfo{connectionType: "Cellular"}, true},
+		{ispInfo{isp: "T-Mobile", mobileCountryCode: "310", mobileNetworkCode: "260"}, true},
+		{ispInfo{connectionType: "Cable/DSL"}, false},
+		{ispInfo{isp: "Comcast"}, false},
+	} {
+		if got := tc.info.isMobile(); got != tc.want {
+			t.Errorf("isMobile(%+v) = %v, want %v", tc.info, got, tc.want)
+		}
+	}
+}
+
+func TestLookupISP(t *testing.T) {
+	defer func() { ispDB, ispDBEnterprise = nil, false }()
+
+	for _, tc := range []struct {
+		dbType     string
+		enterprise bool
+		record     map[string]any
+		want       ispInfo
+	}{
+		{
+			"GeoIP2-ISP", false,
+			map[string]any{"isp": "T-Mobile USA", "organization": "T-Mobile", "mobile_country_code": "310", "mobile_network_code": "260"},
+			ispInfo{isp: "T-Mobile USA", organization: "T-Mobile", mobileCountryCode: "310", mobileNetworkCode: "260"},
+		},
+		{
+			"GeoIP2-Enterprise", true,
+			map[string]any{"traits": map[string]any{"isp": "Comcast Cable", "organization": "Comcast", "connection_type": "Cable/DSL"}},
+			ispInfo{isp: "Comcast Cable", organization: "Comcast", connectionType: "Cable/DSL"},
+		},
+	} {
+		path := writeTestMMDB(t, tc.dbType, map[string]any{"198.51.100.0/24": tc.record})
+		db, err := openMMDB(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		ispDB, ispDBEnterprise = db, tc.enterprise
+
+		network := netip.MustParsePrefix("198.51.0.0/16")
+		info, err := lookupISP(netip.MustParseAddr("198.51.100.7"), &network)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.dbType, err)
+		}
+		if info == nil || *info != tc.want {
+			t.Errorf("%s: info = %+v, want %+v", tc.dbType, info, tc.want)
+		}
+		if network.String() != "198.51.100.0/24" {
+			t.Errorf("%s: network = %s, want 198.51.100.0/24", tc.dbType, network)
+		}
+
+		// 没有记录时返回 nil，而不是空的 ispInfo
+		network = netip.Prefix{}
+		if info, err := lookupISP(netip.MustParseAddr("203.0.113.1"), &network); info != nil || err != nil {
+			t.Errorf("%s: miss = %+v, %v", tc.dbType, info, err)
+		}
+	}
+}
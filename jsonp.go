@@ -0,0 +1,12 @@
+package main
+
+import "regexp"
+
+const maxCallbackLength = 64
+
+// callbackPattern 只允许形如 fn 或 ns.fn 的 JS 标识符，防止通过回调名注入脚本
+var callbackPattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*(\.[A-Za-z_$][A-Za-z0-9_$]*)*$`)
+
+func validCallback(name string) bool {
+	return len(name) <= maxCallbackLength && callbackPattern.MatchString(name)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestValidCallback(t *testing.T) {
+	for name, want := range map[string]bool{
+		"cb":                    true,
+		"jQuery123_456":         true,
+		"$.widget.onGeo":        true,
+		"alert(1)//":            false,
+		"a b":                   false,
+		"1abc":                  false,
+		"ns..fn":                false,
+		"</script>":             false,
+		strings.Repeat("a", 65): false,
+		strings.Repeat("a", 64): true,
+	} {
+		if got := validCallback(name); got != want {
+			t.Errorf("validCallback(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestGeoHandlerJSONP(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(requestIDMiddleware())
+	r.GET("/api/ipinfo", geoHandler)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/ipinfo?ip=127.0.0.1&callback=onGeo", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/javascript") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if body := w.Body.String(); !strings.HasPrefix(body, "onGeo(") || !strings.HasSuffix(body, ");") {
+		t.Errorf("body = %q", body)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/ipinfo?ip=127.0.0.1&callback=alert(1)", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid callback status = %d, want 400", w.Code)
+	}
+}
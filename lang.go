@@ -0,0 +1,127 @@
+package main
+
+import (
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/oschwald/geoip2-golang/v2"
+)
+
+// nameLanguages 为 GeoIP2 Names 提供的语言
+var nameLanguages = []string{"de", "en", "es", "fr", "ja", "pt-BR", "ru", "zh-CN"}
+
+// matchNameLanguage 把语言标签映射为 Names 中的语言：先精确匹配（不区分大小写），
+// 再按主语言匹配，如 en-US → en、zh-TW → zh-CN（库中只有简体中文）
+func matchNameLanguage(tag string) (string, bool) {
+	tag = strings.TrimSpace(strings.ReplaceAll(tag, "_", "-"))
+	for _, lang := range nameLanguages {
+		if strings.EqualFold(tag, lang) {
+			return lang, true
+		}
+	}
+	primary, _, _ := strings.Cut(tag, "-")
+	for _, lang := range nameLanguages {
+		p, _, _ := strings.Cut(lang, "-")
+		if strings.EqualFold(primary, p) {
+			return lang, true
+		}
+	}
+	return "", false
+}
+
+// parseAcceptLanguage 按 q 值从高到低返回请求头中库里可用的语言（去重），
+// q=0 与无法识别的标签被忽略；q 相同时保持原顺序
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		lang string
+		q    float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = f
+		}
+		if q <= 0 {
+			continue
+		}
+		if lang, ok := matchNameLanguage(tag); ok {
+			tags = append(tags, weighted{lang, q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	var langs []string
+	for _, t := range tags {
+		if !slices.Contains(langs, t.lang) {
+			langs = append(langs, t.lang)
+		}
+	}
+	return langs
+}
+
+func nameIn(n geoip2.Names, lang string) string {
+	switch lang {
+	case "de":
+		return n.German
+	case "en":
+		return n.English
+	case "es":
+		return n.Spanish
+	case "fr":
+		return n.French
+	case "ja":
+		return n.Japanese
+	case "pt-BR":
+		return n.BrazilianPortuguese
+	case "ru":
+		return n.Russian
+	case "zh-CN":
+		return n.SimplifiedChinese
+	}
+	return ""
+}
+
+// NameMap 为语言代码到名称的映射，用于 ?names=all
+type NameMap map[string]string
+
+// namesMap 返回各语言的名称，省略库中没有的语言，全部为空时返回 nil
+func namesMap(n geoip2.Names) NameMap {
+	var m NameMap
+	for _, lang := range nameLanguages {
+		if name := nameIn(n, lang); name != "" {
+			if m == nil {
+				m = make(NameMap, len(nameLanguages))
+			}
+			m[lang] = name
+		}
+	}
+	return m
+}
+
+// localizedName 依次取 langs 中第一个非空的名称，最后回退到英文
+func localizedName(n geoip2.Names, langs []string) string {
+	for _, lang := range langs {
+		if name := nameIn(n, lang); name != "" {
+			return name
+		}
+	}
+	return n.English
+}
+
+// localize 按协商出的语言填充 lang / country_name / city_name
+func localize(res *GeoResponse, record *geoip2.City, langs []string) {
+	res.Lang = "en"
+	if len(langs) > 0 {
+		res.Lang = langs[0]
+	}
+	res.CountryName = localizedName(record.Country.Names, langs)
+	res.CityName = localizedName(record.City.Names, langs)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/oschwald/geoip2-golang/v2"
+)
+
+func TestParseAcceptLanguage(t *testing.T) {
+	for header, want := range map[string][]string{
+		"":                                    nil,
+		"zh-TW,zh;q=0.9,en-US;q=0.8,en;q=0.7": {"zh-CN", "en"},
+		"fr-CH, fr;q=0.9, de;q=0.7, *;q=0.5":  {"fr", "de"},
+		"en;q=0.2, ja":                        {"ja", "en"},
+		"pt-br":                               {"pt-BR"},
+		"ko, ru;q=0":                          nil,
+		"de;q=bogus, es":                      {"es"},
+	} {
+		if got := parseAcceptLanguage(header); !reflect.DeepEqual(got, want) {
+			t.Errorf("parseAcceptLanguage(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	record := &geoip2.City{}
+	record.Country.Names = geoip2.Names{English: "Germany", German: "Deutschland", Japanese: "ドイツ"}
+	record.City.Names = geoip2.Names{English: "Munich", Japanese: "ミュンヘン"}
+
+	var res GeoResponse
+	localize(&res, record, []string{"de", "ja"})
+	if res.Lang != "de" || res.CountryName != "Deutschland" || res.CityName != "ミュンヘン" {
+		t.Errorf("got lang=%q country=%q city=%q", res.Lang, res.CountryName, res.CityName)
+	}
+
+	localize(&res, record, nil)
+	if res.Lang != "en" || res.CountryName != "Germany" || res.CityName != "Munich" {
+		t.Errorf("fallback got lang=%q country=%q city=%q", res.Lang, res.CountryName, res.CityName)
+	}
+}
+
+func TestNamesMap(t *testing.T) {
+	got := namesMap(geoip2.Names{English: "Munich", German: "München", SimplifiedChinese: "慕尼黑"})
+	want := NameMap{"en": "Munich", "de": "München", "zh-CN": "慕尼黑"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("namesMap = %v, want %v", got, want)
+	}
+	if got := namesMap(geoip2.Names{}); got != nil {
+		t.Errorf("namesMap(empty) = %v, want nil", got)
+	}
+}
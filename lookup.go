@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"log"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+var lookupCSVHeader = []string{"ip", "country_code", "country", "city", "asn", "organization", "error"}
+
+// 每写入多少行刷新一次响应，也是每批并发查询的行数
+const lookupFlushEvery = 64
+
+// batchWorkers 为批量查询的并发数，由 -batch-workers 设置，默认等于 GOMAXPROCS
+var batchWorkers = runtime.GOMAXPROCS(0)
+
+// lookupHandler 逐行读取 text/plain 请求体中的 IP，边查询边以 CSV 流式返回
+func lookupHandler(c *gin.Context) {
+	if c.ContentType() != "text/plain" {
+		abortWithError(c, http.StatusUnsupportedMediaType, ErrCodeUnsupportedMediaType, "Content-Type must be text/plain")
+		return
+	}
+
+	clearWriteDeadline(c)
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write(lookupCSVHeader)
+
+	scanner := bufio.NewScanner(c.Request.Body)
+	batch := make([]string, 0, lookupFlushEvery)
+	writeBatch := func() {
+		for _, row := range lookupRows(batch, batchWorkers) {
+			w.Write(row)
+		}
+		batch = batch[:0]
+		w.Flush()
+		c.Writer.Flush()
+	}
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		batch = append(batch, line)
+		if len(batch) == lookupFlushEvery {
+			writeBatch()
+		}
+	}
+	err := scanner.Err()
+	if err != nil {
+		requestID, _ := c.Get("RequestID")
+		log.Printf("[%s] Failed to read lookup body: %v", requestID, err)
+	}
+	writeBatch()
+
+	// 响应头已发出，超过 -max-body 时只能在最后追加一行说明
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		w.Write([]string{"", "", "", "", "", "", "request body too large"})
+		w.Flush()
+	}
+}
+
+// lookupRows 以最多 workers 个 goroutine 并发查询，结果顺序与输入一致
+func lookupRows(lines []string, workers int) [][]string {
+	rows := make([][]string, len(lines))
+	workers = min(workers, len(lines))
+	if workers <= 1 {
+		for i, line := range lines {
+			rows[i] = lookupRow(line)
+		}
+		return rows
+	}
+
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for range workers {
+		go func() {
+			defer wg.Done()
+			for i := int(next.Add(1)) - 1; i < len(lines); i = int(next.Add(1)) - 1 {
+				rows[i] = lookupRow(lines[i])
+			}
+		}()
+	}
+	wg.Wait()
+	return rows
+}
+
+func lookupRow(line string) []string {
+	ip, err := parseLookupIP(line)
+	if errors.Is(err, errZonedIP) {
+		return []string{line, "", "", "", "", "", "IP with zone not supported"}
+	}
+	if err != nil {
+		return []string{line, "", "", "", "", "", "invalid IP"}
+	}
+	entry, err := queryGeo(ip)
+	if err != nil {
+		return []string{ip.String(), "", "", "", "", "", "lookup failed"}
+	}
+
+	row := []string{
+		ip.String(),
+		entry.country.Country.ISOCode,
+		entry.country.Country.Names.English,
+		entry.country.City.Names.English,
+		"",
+		"",
+		"",
+	}
+	if entry.asn != nil {
+		row[4] = strconv.FormatUint(uint64(entry.asn.AutonomousSystemNumber), 10)
+		row[5] = entry.asn.AutonomousSystemOrganization
+	}
+	return row
+}
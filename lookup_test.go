@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLookupRowsPreservesOrder(t *testing.T) {
+	lines := make([]string, 100)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("not-an-ip-%d", i)
+	}
+	for _, workers := range []int{0, 1, 4, 200} {
+		rows := lookupRows(lines, workers)
+		if len(rows) != len(lines) {
+			t.Fatalf("workers=%d: got %d rows, want %d", workers, len(rows), len(lines))
+		}
+		for i, row := range rows {
+			if row[0] != lines[i] {
+				t.Fatalf("workers=%d: row %d = %q, want %q", workers, i, row[0], lines[i])
+			}
+		}
+	}
+}
+
+func TestLookupHandler(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(requestIDMiddleware())
+	r.POST("/api/lookup", maxBody(60), lookupHandler)
+
+	post := func(body string, chunked bool) (*httptest.ResponseRecorder, [][]string) {
+		req, _ := http.NewRequest("POST", "/api/lookup", strings.NewReader(body))
+		req.Header.Set("Content-Type", "text/plain")
+		if chunked {
+			req.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		rows, err := csv.NewReader(w.Body).ReadAll()
+		if err != nil {
+			t.Fatalf("invalid CSV %q: %v", w.Body.String(), err)
+		}
+		return w, rows
+	}
+
+	// 空行被跳过，每个非空行对应一行结果，无效输入在 error 列说明原因
+	w, rows := post("127.0.0.1\n\nnot-an-ip\n  fe80::1%eth0  \n", false)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Fatalf("status = %d, Content-Type = %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	want := [][]string{
+		lookupCSVHeader,
+		{"127.0.0.1", "", "", "", "", "", ""},
+		{"not-an-ip", "", "", "", "", "", "invalid IP"},
+		{"fe80::1%eth0", "", "", "", "", "", "IP with zone not supported"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %q, want %q", rows, want)
+	}
+
+	// 分块传输超过 -max-body 时响应头已发出，已读完的 6 行照常返回，最后追加一行说明
+	w, rows = post(strings.Repeat("127.0.0.1\n", 10), true)
+	if w.Code != http.StatusOK || len(rows) != 8 {
+		t.Fatalf("status = %d, rows = %q", w.Code, rows)
+	}
+	if last := rows[len(rows)-1]; !reflect.DeepEqual(last, []string{"", "", "", "", "", "", "request body too large"}) {
+		t.Errorf("last row = %q", last)
+	}
+	for _, row := range rows[1 : len(rows)-1] {
+		if row[0] != "127.0.0.1" || row[6] != "" {
+			t.Errorf("row before the limit = %q", row)
+		}
+	}
+
+	req, _ := http.NewRequest("POST", "/api/lookup", strings.NewReader("8.8.8.8\n"))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("JSON body: status = %d, want 415", w.Code)
+	}
+}
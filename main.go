@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -10,20 +12,28 @@ import (
 	_ "net/http/pprof"
 	"net/netip"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang/groupcache/lru"
-	"github.com/google/uuid"
 	"github.com/natefinch/lumberjack"
 	"github.com/oschwald/geoip2-golang/v2"
+	"golang.org/x/sync/singleflight"
 )
 
 var (
+	// Version、CurrentCommit、BuildDate 在构建时通过 -ldflags "-X main.Version=..." 注入
 	Version       = "dev"
 	CurrentCommit = "unknown"
+	BuildDate     = "unknown"
 	countryDB     *geoip2.Reader
 	asnDB         *geoip2.Reader
 	geoCache      *lru.Cache
@@ -31,98 +41,349 @@ var (
 )
 
 type GeoResponse struct {
-	IP                    string `json:"ip,omitempty"`
-	ContinentCode         string `json:"continent_code,omitempty"`
-	Country               string `json:"country,omitempty"`
-	CountryZH             string `json:"country_zh,omitempty"`
-	CountryCode           string `json:"country_code,omitempty"`
-	City                  string `json:"city,omitempty"`
-	CityZH                string `json:"city_zh,omitempty"`
-	Colo                  string `json:"colo,omitempty"`
-	RegisteredCountryCode string `json:"registered_country_code,omitempty"`
-	ASN                   uint   `json:"asn,omitempty"`
-	Organization          string `json:"organization,omitempty"`
-	ASNIPv4Num            uint   `json:"asn_ipv4_num,omitempty"`
-	Timestamp             int64  `json:"timestamp,omitempty"`
-	RequestID             string `json:"request_id,omitempty"`
-}
-
-func getRealIP(c *gin.Context) string {
-	xff := c.GetHeader("X-Forwarded-For")
-	if xff != "" {
-		for _, ip := range strings.Split(xff, ",") {
-			ip = strings.TrimSpace(ip)
-			parsed := net.ParseIP(ip)
-			if parsed != nil && !parsed.IsPrivate() && !parsed.IsLoopback() {
-				return ip
-			}
-		}
-	}
-	ip, _, _ := net.SplitHostPort(c.Request.RemoteAddr)
-	return ip
+	IP                    string           `json:"ip,omitempty"`
+	IPVersion             uint8            `json:"ip_version,omitempty"` // 4 或 6，IPv4 映射地址按 4 计
+	ContinentCode         string           `json:"continent_code,omitempty"`
+	Country               string           `json:"country,omitempty"`
+	CountryZH             string           `json:"country_zh,omitempty"`
+	CountryCode           string           `json:"country_code,omitempty"`
+	City                  string           `json:"city,omitempty"`
+	CityZH                string           `json:"city_zh,omitempty"`
+	Lang                  string           `json:"lang,omitempty"` // lang、country_name、city_name 仅在携带 ?lang 或 Accept-Language 时返回
+	CountryName           string           `json:"country_name,omitempty"`
+	CityName              string           `json:"city_name,omitempty"`
+	CountryNames          NameMap          `json:"country_names,omitempty"` // country_names、city_names 仅在 ?names=all 时返回
+	CityNames             NameMap          `json:"city_names,omitempty"`
+	RegionCode            string           `json:"region_code,omitempty"`
+	Region                string           `json:"region,omitempty"`
+	RegionZH              string           `json:"region_zh,omitempty"`
+	Subdivisions          []Subdivision    `json:"subdivisions,omitempty"`
+	Colo                  string           `json:"colo,omitempty"`
+	RegisteredCountryCode string           `json:"registered_country_code,omitempty"`
+	AccuracyRadius        uint16           `json:"accuracy_radius,omitempty"`
+	Resolution            string           `json:"resolution,omitempty"`
+	CountryConfidence     uint8            `json:"country_confidence,omitempty"`
+	CityConfidence        uint8            `json:"city_confidence,omitempty"`
+	PostalConfidence      uint8            `json:"postal_confidence,omitempty"`
+	ASN                   uint             `json:"asn,omitempty"`
+	ASNString             string           `json:"asn_string,omitempty"` // 如 "AS15169"，以 asn 为准
+	ASNs                  []uint           `json:"asns,omitempty"`       // 主 ASN 在前，-moas 中的其他起源 ASN 在后
+	Organization          string           `json:"organization,omitempty"`
+	ASNCountry            string           `json:"asn_country,omitempty"`
+	ASNRIR                string           `json:"asn_rir,omitempty"`
+	ASNIPv4Num            uint             `json:"asn_ipv4_num,omitempty"`
+	ASNUpstreams          []uint           `json:"asn_upstreams,omitempty"`
+	ASNPeers              []uint           `json:"asn_peers,omitempty"`
+	ISP                   string           `json:"isp,omitempty"`
+	ISPOrganization       string           `json:"isp_organization,omitempty"`
+	ConnectionType        string           `json:"connection_type,omitempty"`
+	MobileCountryCode     string           `json:"mobile_country_code,omitempty"`
+	MobileNetworkCode     string           `json:"mobile_network_code,omitempty"`
+	IsMobile              bool             `json:"is_mobile,omitempty"` // 仅在加载了 ISP/Enterprise 库时可能为 true
+	IsPrivate             bool             `json:"is_private"`
+	IsLoopback            bool             `json:"is_loopback"`
+	IsGlobal              bool             `json:"is_global"`
+	IsReserved            bool             `json:"is_reserved"`
+	IsHosting             bool             `json:"is_hosting,omitempty"`
+	IsAnycast             bool             `json:"is_anycast,omitempty"`
+	Network               string           `json:"network,omitempty"`
+	Sources               *ResponseSources `json:"sources,omitempty"`
+	DBBuildEpoch          uint             `json:"db_build_epoch,omitempty"` // db_build_epoch、db_build_date 仅在 -db-build-date 时返回
+	DBBuildDate           string           `json:"db_build_date,omitempty"`
+	Timestamp             Timestamp        `json:"timestamp,omitempty"`
+	RequestID             string           `json:"request_id,omitempty"`
+}
+
+// Subdivision 为一级行政区划，GeoResponse.Subdivisions 按从大到小排列
+type Subdivision struct {
+	Code   string `json:"code,omitempty"`
+	Name   string `json:"name,omitempty"`
+	NameZH string `json:"name_zh,omitempty"`
 }
 
 type geoCacheEntry struct {
-	country *geoip2.City
-	asn     *geoip2.ASN
+	country    *geoip2.City
+	asn        *geoip2.ASN
+	confidence *locationConfidence // 仅 Enterprise 库提供
+	asnReg     *asnRegistration    // 来自 -asn-country 补充数据
+	isp        *ispInfo            // 来自 -isp-mmdb
+	// 实际给出结果的数据库，主库无记录时可能来自 -city-fallback/-asn-fallback
+	countrySource *DataSource
+	asnSource     *DataSource
+	ispSource     *DataSource
+	// network 为各库命中记录网段的交集，IPv6 以此作为缓存 key，网段内地址共用该记录
+	network netip.Prefix
+	// asnFailed 表示 ASN 主库查询出错，该记录不写入缓存，以免临时故障导致 ASN 长期缺失
+	asnFailed bool
+	// asnSkipped 表示按 lookupOptions.skipASN 未查询 ASN，需要 ASN 的请求命中时视为未命中并重新查询
+	asnSkipped bool
+	// cachedAt 为写入缓存的时间，供 -cache-ttl 与 -cache-refresh-ahead 判断
+	cachedAt time.Time
+}
+
+// lookupOptions 控制单次查询的范围
+type lookupOptions struct {
+	// skipASN 为 true 时不查询 ASN 库，只需要国家数据的请求可省掉一次数据库查询
+	skipASN bool
+	// noCache 为 true 时跳过缓存读取直接查库，结果仍写回缓存（?nocache=true）
+	noCache bool
+	// cacheHit 非 nil 时记录本次是否命中缓存，供追踪 span 使用
+	cacheHit *bool
+}
+
+func queryGeo(ip netip.Addr) (*geoCacheEntry, error) {
+	return queryGeoWith(ip, lookupOptions{})
+}
+
+func queryGeoWith(ip netip.Addr, opts lookupOptions) (*geoCacheEntry, error) {
+	entry, err := queryGeoMerged(ip, opts)
+	if err != nil || !opts.skipASN || entry.asn == nil {
+		return entry, err
+	}
+	// 命中了完整的缓存记录或覆盖规则，按请求去掉 ASN，不修改共享的缓存对象
+	stripped := *entry
+	stripped.asn, stripped.asnReg, stripped.asnSource = nil, nil, nil
+	return &stripped, nil
+}
+
+func queryGeoMerged(ip netip.Addr, opts lookupOptions) (*geoCacheEntry, error) {
+	// 覆盖规则优先于缓存和数据库，且不写入缓存，保证重新加载后立即生效
+	o := lookupOverride(ip)
+	if o == nil {
+		return queryGeoCached(ip, opts)
+	}
+	entry := &geoCacheEntry{country: o.cityRecord(), asn: o.asnRecord(), network: o.prefix}
+	if entry.country != nil {
+		entry.countrySource = overrideSource
+	}
+	if entry.asn != nil {
+		entry.asnSource = overrideSource
+	}
+	if entry.country == nil || entry.asn == nil {
+		// 只覆盖了部分字段，其余仍取自数据库
+		dbEntry, err := queryGeoCached(ip, opts)
+		if err != nil {
+			return nil, err
+		}
+		if entry.country == nil {
+			entry.country = dbEntry.country
+			entry.confidence = dbEntry.confidence
+			entry.countrySource = dbEntry.countrySource
+		}
+		if entry.asn == nil {
+			entry.asn = dbEntry.asn
+			entry.asnReg = dbEntry.asnReg
+			entry.asnSource = dbEntry.asnSource
+		}
+		entry.isp = dbEntry.isp
+		entry.ispSource = dbEntry.ispSource
+		entry.network = narrowNetwork(entry.network, dbEntry.network)
+	}
+	if entry.asnReg == nil {
+		entry.asnReg = lookupASNRegistration(entry.asn)
+	}
+	return entry, nil
 }
 
-func queryGeo(ip netip.Addr) (*geoip2.City, *geoip2.ASN, error) {
-	ipStr := ip.String()
+func queryGeoCached(ip netip.Addr, opts lookupOptions) (*geoCacheEntry, error) {
+	// -cache 0 时不使用缓存，直接查询数据库
+	if geoCache == nil {
+		return withLookupDeadline(func() (*geoCacheEntry, error) {
+			return lookupDatabases(ip, opts)
+		})
+	}
+
+	if !opts.noCache {
+		if entry, ok := cacheGet(ip); ok && (!entry.asnSkipped || opts.skipASN) {
+			cacheHits.Add(1)
+			if opts.cacheHit != nil {
+				*opts.cacheHit = true
+			}
+			maybeRefresh(ip, entry)
+			return entry, nil
+		}
+		cacheMisses.Add(1)
+	}
+
+	// 缓存未命中，查询数据库
+	if cacheOnly() {
+		return nil, errDBUnavailable
+	}
+
+	entry, err := withLookupDeadline(func() (*geoCacheEntry, error) {
+		return lookupAndCacheOnce(ip, opts)
+	})
+	if errors.Is(err, errLookupTimeout) && !opts.noCache {
+		// 超时期间其他请求可能已写入缓存
+		if cached, ok := cacheGet(ip); ok && (!cached.asnSkipped || opts.skipASN) {
+			return cached, nil
+		}
+	}
+	return entry, err
+}
 
+func cacheGet(ip netip.Addr) (*geoCacheEntry, bool) {
 	// LRU cache 的 Get 操作会修改内部链表（MoveToFront），需要使用写锁
 	cacheMutex.Lock()
-	if v, ok := geoCache.Get(ipStr); ok {
-		cacheMutex.Unlock()
-		entry := v.(*geoCacheEntry)
-		return entry.country, entry.asn, nil
+	defer cacheMutex.Unlock()
+	var entry *geoCacheEntry
+	if aggregateIPv6(ip) {
+		entry, _ = cacheGetIPv6(ip)
+	} else if v, ok := geoCache.Get(ip.String()); ok {
+		entry = v.(*geoCacheEntry)
 	}
-	cacheMutex.Unlock()
+	// 过期的记录留在 LRU 中，由下一次查询结果覆盖或自然淘汰
+	if entry == nil || cacheExpired(entry, time.Now()) {
+		return nil, false
+	}
+	return entry, true
+}
 
-	// 缓存未命中，查询数据库
-	cityRecord, err := countryDB.City(ip)
-	if err != nil {
-		return nil, nil, err
+// lookupGroup 合并同一 IP 同时发生的缓存未命中，热点 IP 冷启动时只查一次库
+var lookupGroup singleflight.Group
+
+// lookupAndCacheOnce 以 IP 与是否跳过 ASN 为 key 合并并发查询，其余调用方等待并共享同一条记录
+func lookupAndCacheOnce(ip netip.Addr, opts lookupOptions) (*geoCacheEntry, error) {
+	key := ip.String()
+	if opts.skipASN {
+		key += "|noasn"
 	}
+	v, err, _ := lookupGroup.Do(key, func() (any, error) {
+		return lookupAndCache(ip, opts)
+	})
+	entry, _ := v.(*geoCacheEntry)
+	return entry, err
+}
 
-	asnRecord, err := asnDB.ASN(ip)
+// lookupAndCache 查询并写入缓存；只查国家的记录先写入，之后需要 ASN 的请求查询到完整记录时覆盖
+func lookupAndCache(ip netip.Addr, opts lookupOptions) (*geoCacheEntry, error) {
+	// 持有 dbMutex 读锁直到写入缓存，保证热加载清空缓存后不会再写入旧库的数据
+	dbMutex.RLock()
+	defer dbMutex.RUnlock()
+
+	entry, err := lookupDatabasesLocked(ip, opts)
 	if err != nil {
-		return cityRecord, nil, err
+		return entry, err
+	}
+
+	if entry.asnFailed {
+		return entry, nil
 	}
 
 	// 写入缓存
 	cacheMutex.Lock()
-	geoCache.Add(ipStr, &geoCacheEntry{country: cityRecord, asn: asnRecord})
+	cacheAdd(cacheKey(ip, entry), entry)
 	cacheMutex.Unlock()
 
-	return cityRecord, asnRecord, nil
+	return entry, nil
 }
 
-func geoHandler(c *gin.Context) {
-	queryIP := c.Query("ip")
-	var ipStr string
+func lookupDatabases(ip netip.Addr, opts lookupOptions) (*geoCacheEntry, error) {
+	if cacheOnly() {
+		return nil, errDBUnavailable
+	}
+	dbMutex.RLock()
+	defer dbMutex.RUnlock()
+	return lookupDatabasesLocked(ip, opts)
+}
 
-	if queryIP != "" {
-		ipStr = queryIP
-	} else {
-		ipStr = getRealIP(c)
+// lookupDatabasesLocked 依次查询各数据库，调用方需持有 dbMutex 读锁
+func lookupDatabasesLocked(ip netip.Addr, opts lookupOptions) (*geoCacheEntry, error) {
+	// 缺少的数据库（降级模式）对应字段留空
+	entry := &geoCacheEntry{country: &geoip2.City{}}
+	var err error
+	if countryDB != nil {
+		if countryDBEnterprise {
+			entry.country, entry.confidence, err = lookupEnterprise(ip)
+		} else {
+			entry.country, err = countryDB.City(ip)
+		}
+		countryHealth.observe(err)
+		if err != nil {
+			return nil, err
+		}
+		entry.network = narrowNetwork(entry.network, entry.country.Traits.Network)
+		if entry.country.HasData() {
+			entry.countrySource = newDataSource(countryDBPath, countryDB)
+		}
+	}
+	if entry.countrySource == nil {
+		if record, src := lookupCityFallback(ip, &entry.network); record != nil {
+			entry.country, entry.confidence, entry.countrySource = record, nil, src
+		}
 	}
 
-	ip, err := netip.ParseAddr(ipStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid IP"})
-		return
+	if opts.skipASN {
+		entry.asnSkipped = true
+	} else if asnDB != nil {
+		entry.asn, err = asnDB.ASN(ip)
+		asnHealth.observe(err)
+		if err != nil {
+			// ASN 只影响 ASN 相关字段，国家数据照常返回；只有城市库查询失败才是硬错误
+			log.Printf("ASN lookup failed for %s: %v", ip, err)
+			entry.asn, entry.asnFailed = nil, true
+		} else {
+			entry.network = narrowNetwork(entry.network, entry.asn.Network)
+			if entry.asn.HasData() {
+				entry.asnSource = newDataSource(asnDBPath, asnDB)
+			}
+		}
+	}
+	if entry.asnSource == nil && !opts.skipASN {
+		if record, src := lookupASNFallback(ip, &entry.network); record != nil {
+			entry.asn, entry.asnSource = record, src
+		}
+	}
+	if entry.asn != nil {
+		recordASNOrg(entry.asn.AutonomousSystemNumber, entry.asn.AutonomousSystemOrganization)
+		entry.asnReg = lookupASNRegistration(entry.asn)
 	}
 
-	cityRecord, asnRecord, err := queryGeo(ip)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "GeoIP lookup failed"})
-		return
+	if entry.countrySource != nil {
+		dbAnswers.WithLabelValues("city", entry.countrySource.Database).Inc()
+	}
+	if entry.asnSource != nil {
+		dbAnswers.WithLabelValues("asn", entry.asnSource.Database).Inc()
 	}
 
-	requestID, _ := c.Get("RequestID")
+	if ispDB != nil {
+		// ISP 库只是补充信息，查询失败不影响其余字段
+		if entry.isp, err = lookupISP(ip, &entry.network); err != nil {
+			log.Printf("ISP lookup failed for %s: %v", ip, err)
+		} else if entry.isp != nil {
+			entry.ispSource = newDataSource(ispDBPath, ispDB)
+		}
+	}
+
+	return entry, nil
+}
+
+// resolution 的取值：结果精确到城市、只有国家，或两者都没有
+const (
+	resolutionCity    = "city"
+	resolutionCountry = "country"
+	resolutionNone    = "none"
+)
+
+// resolutionOf 按记录中是否有城市名、国家代码判断定位粒度，GeoLite 库同样适用
+func resolutionOf(r *geoip2.City) string {
+	switch {
+	case r.City.Names.HasData():
+		return resolutionCity
+	case r.Country.ISOCode != "":
+		return resolutionCountry
+	}
+	return resolutionNone
+}
+
+// newGeoResponse 由缓存记录组装响应，不含时间戳、RequestID 等请求相关字段。
+// 缓存层（queryGeo）只保存与语言、字段选择无关的解码记录，本地化与字段裁剪都在此之后进行，
+// 因此同一条缓存可服务所有请求参数组合，缓存 key 只需要 IP（IPv6 为所在网段）。
+func newGeoResponse(ip netip.Addr, entry *geoCacheEntry) GeoResponse {
+	cityRecord, asnRecord := entry.country, entry.asn
 	res := GeoResponse{
 		IP:                    ip.String(),
+		IPVersion:             ipVersion(ip),
 		ContinentCode:         cityRecord.Continent.Code,
 		Country:               cityRecord.Country.Names.English,
 		CountryZH:             cityRecord.Country.Names.SimplifiedChinese,
@@ -130,27 +391,322 @@ func geoHandler(c *gin.Context) {
 		City:                  cityRecord.City.Names.English,
 		CityZH:                cityRecord.City.Names.SimplifiedChinese,
 		RegisteredCountryCode: cityRecord.RegisteredCountry.ISOCode,
-		Timestamp:             time.Now().UnixMilli(),
-		RequestID:             requestID.(string),
+		AccuracyRadius:        cityRecord.Location.AccuracyRadius,
+		Resolution:            resolutionOf(cityRecord),
 	}
 
+	for _, sub := range cityRecord.Subdivisions {
+		res.Subdivisions = append(res.Subdivisions, Subdivision{
+			Code:   sub.ISOCode,
+			Name:   sub.Names.English,
+			NameZH: sub.Names.SimplifiedChinese,
+		})
+	}
+	if len(res.Subdivisions) > 0 {
+		res.RegionCode = res.Subdivisions[0].Code
+		res.Region = res.Subdivisions[0].Name
+		res.RegionZH = res.Subdivisions[0].NameZH
+	}
+
+	if entry.countrySource != nil || entry.asnSource != nil || entry.ispSource != nil {
+		res.Sources = &ResponseSources{Country: entry.countrySource, ASN: entry.asnSource, ISP: entry.ispSource}
+	}
+
+	if aggregateIPv6(ip) && entry.network.IsValid() {
+		res.Network = entry.network.String()
+	}
+
+	class := classifyAddr(ip)
+	res.IsPrivate = class.private
+	res.IsLoopback = class.loopback
+	res.IsGlobal = class.global
+	res.IsReserved = class.reserved
+
+	if conf := entry.confidence; conf != nil {
+		res.CountryConfidence = conf.country
+		res.CityConfidence = conf.city
+		res.PostalConfidence = conf.postal
+	}
 	if asnRecord != nil {
 		res.ASN = asnRecord.AutonomousSystemNumber
+		if res.ASN != 0 {
+			res.ASNString = "AS" + strconv.FormatUint(uint64(res.ASN), 10)
+			res.ASNs = lookupASNs(ip, res.ASN)
+		}
 		res.Organization = asnRecord.AutonomousSystemOrganization
+		res.IsHosting = isHostingASN(res.ASN)
+		res.ASNUpstreams, res.ASNPeers = lookupASNRelations(res.ASN)
 		// res.ASNIPv4Num = asnRecord.AutonomousSystemNumber
 	}
-	if colo := strings.TrimSpace(c.GetHeader("Cf-Ray")); colo != "" {
-		res.Colo = strings.Split(colo, "-")[1]
+	// anycast 网段在多地提供服务，坐标仅代表其中一处
+	res.IsAnycast = cityRecord.Traits.IsAnycast || isAnycastListed(ip, res.ASN)
+	if entry.isp != nil {
+		res.ISP = entry.isp.isp
+		res.ISPOrganization = entry.isp.organization
+		res.ConnectionType = entry.isp.connectionType
+		res.MobileCountryCode = entry.isp.mobileCountryCode
+		res.MobileNetworkCode = entry.isp.mobileNetworkCode
+		res.IsMobile = entry.isp.isMobile()
+	}
+	if entry.asnReg != nil {
+		res.ASNCountry = entry.asnReg.Country
+		res.ASNRIR = entry.asnReg.RIR
+	}
+	return res
+}
+
+func geoHandler(c *gin.Context) {
+	ip, err := requestedIP(c)
+	if err != nil {
+		abortInvalidIP(c, err)
+		return
+	}
+
+	fieldsParam := c.DefaultQuery("fields", defaultFields)
+	fields, unknown := parseFields(fieldsParam)
+	if len(unknown) > 0 {
+		abortWithError(c, http.StatusBadRequest, ErrCodeInvalidParam, unknownFieldsMessage(unknown))
+		return
+	}
+	// 旧的嵌入式组件只能使用 JSONP，仅在携带 ?callback= 时包装响应
+	callback := c.Query("callback")
+	if callback != "" && !validCallback(callback) {
+		abortWithError(c, http.StatusBadRequest, ErrCodeInvalidParam, "callback: must be a JavaScript identifier such as fn or ns.fn (max 64 chars)")
+		return
+	}
+	// 显式的 ?lang 优先于 Accept-Language，二者都没有时不返回本地化字段
+	var langs []string
+	negotiated := false
+	if v := c.Query("lang"); v != "" {
+		lang, ok := matchNameLanguage(v)
+		if !ok {
+			abortWithError(c, http.StatusBadRequest, ErrCodeInvalidParam, "lang: must be one of "+strings.Join(nameLanguages, ", "))
+			return
+		}
+		langs, negotiated = []string{lang}, true
+	} else {
+		c.Writer.Header().Add("Vary", "Accept-Language")
+		if h := c.GetHeader("Accept-Language"); h != "" {
+			langs, negotiated = parseAcceptLanguage(h), true
+		}
+	}
+	// ?names=all 时额外返回各语言的国家/城市名
+	allNames := false
+	if v := c.Query("names"); v != "" {
+		if v != "all" {
+			abortWithError(c, http.StatusBadRequest, ErrCodeInvalidParam, "names: must be all")
+			return
+		}
+		allNames = true
+	}
+	// ?nocache=true 绕过缓存直接查库，需要 -admin-token，排查缓存中的旧数据时不必清空整个缓存
+	noCache := false
+	if v := c.Query("nocache"); v != "" {
+		if noCache, err = strconv.ParseBool(v); err != nil {
+			abortWithError(c, http.StatusBadRequest, ErrCodeInvalidParam, "nocache: must be true or false")
+			return
+		}
+		if noCache && !hasToken(c, adminToken) {
+			abortWithError(c, http.StatusUnauthorized, ErrCodeUnauthorized, "nocache requires the admin token")
+			return
+		}
+		if noCache {
+			c.Header("Cache-Control", "no-store")
+		}
+	}
+	// ?asn=false 时跳过 ASN 库，只返回国家/城市等数据
+	withASN := true
+	if v := c.Query("asn"); v != "" {
+		if withASN, err = strconv.ParseBool(v); err != nil {
+			abortWithError(c, http.StatusBadRequest, ErrCodeInvalidParam, "asn: must be true or false")
+			return
+		}
+	}
+	// ?date=YYYY-MM-DD 时改用 -archive-dir 中当天适用的历史库
+	var date time.Time
+	if v := c.Query("date"); v != "" {
+		if archives == nil {
+			abortWithError(c, http.StatusBadRequest, ErrCodeInvalidParam, "date: requires -archive-dir")
+			return
+		}
+		if date, err = time.Parse(time.DateOnly, v); err != nil {
+			abortWithError(c, http.StatusBadRequest, ErrCodeInvalidParam, "date: must be YYYY-MM-DD")
+			return
+		}
+	}
+	geoJSON := false
+	if v := c.Query("geojson"); v != "" {
+		if geoJSON, err = strconv.ParseBool(v); err != nil {
+			abortWithError(c, http.StatusBadRequest, ErrCodeInvalidParam, "geojson: must be true or false")
+			return
+		}
+	}
+	useEnvelope := envelopeDefault
+	if v := c.Query("envelope"); v != "" {
+		if useEnvelope, err = strconv.ParseBool(v); err != nil {
+			abortWithError(c, http.StatusBadRequest, ErrCodeInvalidParam, "envelope: must be true or false")
+			return
+		}
+	}
+	if geoJSON && callback != "" {
+		abortWithError(c, http.StatusBadRequest, ErrCodeInvalidParam, "geojson: cannot be combined with callback")
+		return
+	}
+
+	// Cf-Ray 形如 "<ray id>-<colo>"，不含 "-" 的值视为无效并忽略
+	_, colo, _ := strings.Cut(strings.TrimSpace(c.GetHeader("Cf-Ray")), "-")
+	// -response-cache 命中时直接返回序列化好的响应，跳过查库与序列化；nocache 请求既不读也不写
+	var respKey string
+	if respCache != nil && !noCache {
+		acceptLanguage := ""
+		if c.Query("lang") == "" {
+			acceptLanguage = c.GetHeader("Accept-Language")
+		}
+		respKey = responseCacheKey(ip.String(), c.Request.URL.RawQuery, acceptLanguage, colo)
+		if cached, ok := respCache.get(respKey); ok {
+			topIPs.add(ip.String())
+			serveCachedResponse(c, cached)
+			return
+		}
+	}
+
+	entry, err := tracedQueryGeo(c.Request.Context(), ip, lookupOptions{skipASN: !withASN, noCache: noCache})
+	if errors.Is(err, errDBUnavailable) {
+		abortWithError(c, http.StatusServiceUnavailable, ErrCodeDBUnavailable, "Database unavailable")
+		return
+	}
+	if err == nil && !date.IsZero() {
+		if entry, err = archives.apply(ip, date, entry); err != nil {
+			requestID, _ := c.Get("RequestID")
+			log.Printf("[%s] Archive lookup failed for %s on %s: %v", requestID, ip, date.Format(time.DateOnly), err)
+		}
+	}
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, ErrCodeLookupFailed, "GeoIP lookup failed")
+		return
+	}
+
+	topIPs.add(ip.String())
+
+	requestID, _ := c.Get("RequestID")
+	res := newGeoResponse(ip, entry)
+	res.Timestamp = Timestamp(time.Now().UnixMilli())
+	res.RequestID = requestID.(string)
+	if negotiated {
+		localize(&res, entry.country, langs)
+	}
+	if includeDBBuild {
+		if epoch := cityBuildEpoch(entry); epoch > 0 {
+			res.DBBuildEpoch = epoch
+			res.DBBuildDate = time.Unix(int64(epoch), 0).UTC().Format(time.RFC3339)
+		}
+	}
+	if allNames {
+		res.CountryNames = namesMap(entry.country.Country.Names)
+		res.CityNames = namesMap(entry.country.City.Names)
+	}
+	res.Colo = colo
+	if respKey != "" {
+		// 写入缓存的响应体以占位值代替 request_id 与 timestamp，返回时再替换
+		res.Timestamp = respTimestampSentinel
+		res.RequestID = respRequestIDSentinel
+	}
+
+	body := responseBody(&res, fields)
+	// GeoJSON 本身就是固定结构的 Feature，不再套 envelope
+	wrap := useEnvelope && !geoJSON
+	if wrap {
+		data, meta := envelopeParts(res)
+		body = responseEnvelope{Data: responseBody(&data, fields), Meta: meta}
+	}
+	if geoJSON {
+		feature, ok := newGeoJSONFeature(entry.country.Location, body)
+		if !ok {
+			abortWithError(c, http.StatusNotFound, ErrCodeNoData, "Coordinates unavailable for this IP")
+			return
+		}
+		body = feature
+	}
+
+	variant := fieldsParam
+	if callback != "" {
+		variant += "|callback=" + callback
+	}
+	if geoJSON {
+		variant += "|geojson"
+	}
+	if wrap {
+		variant += "|envelope"
+	}
+	if !date.IsZero() {
+		variant += "|date=" + date.Format(time.DateOnly)
+	}
+	etag := geoETag(res, variant)
+	c.Header("ETag", etag)
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	if respKey != "" {
+		cached := &cachedResponse{contentType: "application/json; charset=utf-8", etag: etag}
+		if callback != "" {
+			cached.contentType = "application/javascript; charset=utf-8"
+		}
+		if geoJSON {
+			cached.contentType = "application/geo+json; charset=utf-8"
+		}
+		if cached.body, err = serializeResponse(body, callback); err != nil {
+			abortWithError(c, http.StatusInternalServerError, ErrCodeLookupFailed, "Failed to encode response")
+			return
+		}
+		respCache.add(respKey, cached)
+		serveCachedResponse(c, cached)
+		return
+	}
+
+	if geoJSON {
+		c.Header("Content-Type", "application/geo+json; charset=utf-8")
+	}
+	c.JSONP(http.StatusOK, body)
+}
+
+// serveCachedResponse 以本次请求的 request_id 与时间写出缓存的响应，If-None-Match 匹配时返回 304
+func serveCachedResponse(c *gin.Context, cached *cachedResponse) {
+	c.Header("ETag", cached.etag)
+	if etagMatches(c.GetHeader("If-None-Match"), cached.etag) {
+		c.Status(http.StatusNotModified)
+		return
 	}
+	requestID, _ := c.Get("RequestID")
+	id, _ := requestID.(string)
+	c.Data(http.StatusOK, cached.contentType, cached.render(id, Timestamp(time.Now().UnixMilli())))
+}
 
-	c.JSON(http.StatusOK, res)
+const maxRequestIDLength = 128
+
+// sanitizeRequestID 校验客户端传入的 X-Request-ID，超长或包含控制字符（如 CR/LF）时
+// 返回空串以生成新的 ID，防止日志注入
+func sanitizeRequestID(id string) string {
+	if len(id) > maxRequestIDLength {
+		return ""
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x20 || id[i] == 0x7f {
+			return ""
+		}
+	}
+	return id
 }
 
 func requestIDMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		requestID := c.Request.Header.Get("X-Request-ID")
+		requestID := sanitizeRequestID(c.Request.Header.Get("X-Request-ID"))
+		if requestID == "" && traceparentRequestID {
+			requestID = traceIDFromTraceparent(c.GetHeader("traceparent"))
+		}
 		if requestID == "" {
-			requestID = uuid.NewString()
+			requestID = newRequestID()
 		}
 		c.Set("RequestID", requestID)
 		c.Writer.Header().Set("X-Request-ID", requestID)
@@ -169,72 +725,488 @@ func init() {
 	}
 }
 
+// newRouter 创建挂好全局中间件的路由。NoRoute/NoMethod 同样经过这些中间件；
+// 访问日志在 c.Next() 返回后才读取 RequestID，因此排在 requestIDMiddleware 之前也能拿到，404/405 也不例外
+func newRouter(accessLog bool, slowThreshold time.Duration) *gin.Engine {
+	r := gin.New()
+	r.HandleMethodNotAllowed = true
+	r.NoRoute(notFoundHandler)
+	r.NoMethod(methodNotAllowedHandler)
+
+	// -access-log=false 时只去掉逐请求访问日志，panic 恢复与错误日志照常
+	if accessLog {
+		r.Use(accessLogger())
+	}
+	r.Use(recoveryMiddleware())
+
+	r.Use(tracingMiddleware(), requestIDMiddleware(), statsMiddleware(), metricsMiddleware(), slowestMiddleware())
+	if slowThreshold > 0 {
+		r.Use(slowLogger(slowThreshold))
+	}
+	return r
+}
+
+// accessLogger Custom logger formatter，每个请求输出一行带 RequestID 的访问日志
+func accessLogger() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
+		requestID, _ := param.Keys["RequestID"].(string)
+		return fmt.Sprintf("[%s] %s - [%s] \"%s %s %s\" %d %d \"%s\" \"%s\" \"%s\" \"%s\" \"%s\"\n",
+			param.TimeStamp.Format(time.RFC3339),
+			param.ClientIP,
+			requestID,
+			param.Method,
+			param.Path,
+			param.Request.Proto,
+			param.StatusCode,
+			param.Latency.Microseconds(),
+			param.Request.Host,
+			param.Request.UserAgent(),
+			param.Request.Header.Get("X-Forwarded-For"),
+			param.Request.Header.Get("X-Real-IP"),
+			param.Request.RemoteAddr,
+		)
+	})
+}
+
 func main() {
 	cityMMDBPath := flag.String("city-mmdb", "GeoLite2-City.mmdb", "Path to GeoLite2-City.mmdb")
 	asnMMDBPath := flag.String("asn-mmdb", "GeoLite2-ASN.mmdb", "Path to GeoLite2-ASN.mmdb")
-	port := flag.String("port", ":8399", "HTTP server port")
-	cacheSize := flag.Int("cache", 10000, "Number of LRU cache entries")
-	logPath := flag.String("log", "geo.log", "Log file path")
+	ispMMDBPath := flag.String("isp-mmdb", "", "Optional path to a GeoIP2-ISP or GeoIP2-Enterprise mmdb")
+	dbCacheDir := flag.String("db-cache-dir", filepath.Join(os.TempDir(), "geoip-server"), "Directory caching databases downloaded from http(s):// or s3:// -city-mmdb/-asn-mmdb/-isp-mmdb URLs across restarts")
+	downloadTimeout := flag.Duration("download-timeout", 5*time.Minute, "Maximum duration of one database download attempt")
+	downloadProxy := flag.String("download-proxy", "", "Proxy URL for database downloads (default uses HTTPS_PROXY/HTTP_PROXY)")
+	downloadRetries := flag.Int("download-retries", 3, "Retries after a temporary database download failure")
+	var cityFallbackPaths, asnFallbackPaths listFlag
+	flag.Var(&cityFallbackPaths, "city-fallback", "Secondary city mmdb consulted in order when -city-mmdb has no record, repeatable or comma separated")
+	flag.Var(&asnFallbackPaths, "asn-fallback", "Secondary ASN mmdb consulted in order when -asn-mmdb has no record, repeatable or comma separated")
+	flag.StringVar(&compareDBPath, "compare-city-mmdb", "", "Candidate city mmdb compared against -city-mmdb by /api/compare (requires -admin-token)")
+	archiveDir := flag.String("archive-dir", "", "Directory of dated city/ASN mmdbs (e.g. GeoLite2-City_20230101.mmdb) queried by ?date=YYYY-MM-DD")
+	archiveReaders := flag.Int("archive-readers", 4, "Maximum archived databases kept open at once")
+	var ports, tlsPorts listFlag
+	flag.Var(&ports, "port", "HTTP listen address, repeatable or comma separated (default :8399)")
+	flag.Var(&tlsPorts, "tls-port", "HTTPS listen address, repeatable or comma separated")
+	tlsCert := flag.String("tls-cert", "", "TLS certificate file for -tls-port")
+	tlsKey := flag.String("tls-key", "", "TLS private key file for -tls-port")
+	enableH2C := flag.Bool("h2c", false, "Accept HTTP/2 cleartext (h2c) on -port listeners")
+	portFile := flag.String("port-file", "", "Write the resolved listen addresses (one per line) to this file once bound, useful with -port :0")
+	maxConcurrent := flag.Int("max-concurrent", 0, "Maximum in-flight requests before answering 503 with Retry-After; health checks and /metrics are exempt (0 disables)")
+	compressMinBytes := flag.Int("compress-min-bytes", 1024, "Compress responses of at least this many bytes with br or gzip per Accept-Encoding (0 disables)")
+	readTimeout := flag.Duration("read-timeout", 30*time.Second, "Maximum duration for reading an entire request including the body (0 disables)")
+	readHeaderTimeout := flag.Duration("read-header-timeout", 5*time.Second, "Maximum duration for reading request headers, guards against Slowloris (0 disables)")
+	writeTimeout := flag.Duration("write-timeout", 30*time.Second, "Maximum duration for writing a response; streaming export, walk and batch lookup are exempt (0 disables)")
+	idleTimeout := flag.Duration("idle-timeout", 120*time.Second, "Maximum keep-alive idle time between requests (0 disables)")
+	cacheSize := flag.Int("cache", 10000, "Number of LRU cache entries (0 disables caching)")
+	cacheBytesLimit := flag.Int64("cache-bytes", 0, "Bound the LRU cache by approximate memory in bytes instead of entry count (0 uses -cache)")
+	cacheTTLFlag := flag.Duration("cache-ttl", 0, "Treat cache entries older than this as misses (0 never expires)")
+	refreshAhead := flag.Duration("cache-refresh-ahead", 0, "Refresh entries in the background when served within this long of -cache-ttl (0 disables)")
+	refreshWorkers := flag.Int("cache-refresh-workers", 4, "Maximum concurrent background cache refreshes")
+	respCacheSize := flag.Int("response-cache", 0, "Number of serialized /api/ipinfo responses cached by exact query (0 disables)")
+	respCacheTTL := flag.Duration("response-cache-ttl", time.Minute, "Maximum age of a cached /api/ipinfo response (0 keeps until evicted or reloaded)")
+	cacheReport := flag.Duration("cache-report", 5*time.Minute, "Interval for logging cache hit ratio, size and evictions (0 disables)")
+	sloWebhook := flag.String("slo-webhook", "", "URL receiving a JSON POST when a route's p99 latency exceeds -slo-p99")
+	sloP99 := flag.Duration("slo-p99", 100*time.Millisecond, "p99 latency SLO per route checked for -slo-webhook")
+	sloWindow := flag.Duration("slo-window", time.Minute, "Window over which per-route p99 latency is computed for -slo-webhook")
+	sloCooldown := flag.Duration("slo-cooldown", 10*time.Minute, "Minimum interval between SLO alerts for the same route")
+	topCapacity := flag.Int("top-capacity", 1000, "Number of counters kept for /api/top (bounds memory)")
+	slowCapacity := flag.Int("slow-capacity", 50, "Number of slowest recent requests kept for /api/slow")
+	slowWindow := flag.Duration("slow-window", time.Hour, "How long a request stays eligible for /api/slow (0 keeps the slowest since startup)")
+	flag.Int64Var(&maxBodyBytes, "max-body", maxBodyBytes, "Maximum request body size in bytes for POST endpoints (0 disables)")
+	flag.IntVar(&batchWorkers, "batch-workers", batchWorkers, "Concurrent lookups per /api/lookup request (default GOMAXPROCS)")
+	warmFile := flag.String("warm-file", "", "File of IPs (one per line) looked up at startup to pre-populate the cache")
+	cacheSnapshotPath := flag.String("cache-snapshot", "", "File the cache is saved to on shutdown and restored from at startup (empty disables)")
+	cacheSnapshotTTL := flag.Duration("cache-snapshot-ttl", time.Hour, "Discard a -cache-snapshot older than this at startup (0 never expires)")
+	logPath := flag.String("log", "geo.log", "Log file path (empty or - logs to stdout only)")
 	logSize := flag.Int("logsize", 10, "Max size (MB) per log file")
 	logBackups := flag.Int("logbackups", 5, "Number of backup logs to retain")
 	logAge := flag.Int("logage", 14, "Max age (days) to retain logs")
+	requestIDFormat := flag.String("request-id-format", requestIDUUID, "Format of generated request IDs: uuid, hex32 (W3C trace-id style) or short")
+	flag.BoolVar(&traceparentRequestID, "request-id-traceparent", false, "Reuse the trace-id of an incoming W3C traceparent header as the request ID when X-Request-ID is absent")
+	accessLog := flag.Bool("access-log", true, "Write a per-request access log line (errors and panics are still logged when disabled)")
+	slowThreshold := flag.Duration("slow-threshold", 0, "Log a WARN line for requests slower than this, e.g. 50ms (0 disables)")
+	overridesPath := flag.String("overrides", "", "CSV file of CIDR overrides: cidr,country_code,asn,organization")
+	trustedProxyList := flag.String("trusted-proxies", strings.Join(defaultTrustedProxies, ","), "Comma separated CIDRs of proxies whose X-Forwarded-For hops are skipped")
+	flag.BoolVar(&trustAllProxies, "trust-all-proxies", false, "Trust X-Forwarded-For from any peer, not only -trusted-proxies (only behind a trusted load balancer)")
+	flag.StringVar(&forwardedHeader, "forwarded-header", forwardedHeaderAuto, "Client IP header from trusted proxies: auto, xff or forwarded (RFC 7239)")
+	flag.StringVar(&clientSubnetHeader, "client-subnet-header", "", "Header (e.g. X-Client-Subnet) carrying a client CIDR from trusted proxies, used as the lookup target when ?ip is absent")
+	denyCountries := flag.String("deny-countries", "", "Comma separated ISO country codes whose callers get 403")
+	denyASNs := flag.String("deny-asns", "", "Comma separated ASNs whose callers get 403")
+	var denyGroups listFlag
+	flag.Var(&denyGroups, "deny-groups", "Route groups the deny list applies to: api, admin, ui (default api)")
+	flag.StringVar(&defaultFields, "fields", "", "Default comma separated response fields when ?fields= is absent (empty returns all)")
+	fieldNamesPath := flag.String("field-names", "", "File of field=name lines renaming /api/ipinfo JSON fields, e.g. country_code=cc")
+	flag.BoolVar(&includeDBBuild, "db-build-date", false, "Include db_build_epoch and db_build_date of the city database in /api/ipinfo responses")
+	flag.BoolVar(&envelopeDefault, "envelope", false, "Wrap /api/ipinfo responses as {\"data\": ..., \"meta\": ...} by default (?envelope= overrides)")
+	flag.StringVar(&timestampFormat, "timestamp-format", timestampMillis, "Serialization of the response timestamp: millis, unix or rfc3339")
+	enableUI := flag.Bool("ui", true, "Serve the built-in web UI at /")
+	requireAllDBs := flag.Bool("require-all-dbs", false, "Exit if any database fails to open instead of running degraded")
+	flag.StringVar(&adminToken, "admin-token", "", "Token required by debug/admin endpoints and ?nocache=; empty disables them")
+	hostingASNsPath := flag.String("hosting-asns", "", "File of hosting/datacenter ASNs (one per line) used to set is_hosting")
+	anycastListPath := flag.String("anycast-list", "", "File of known anycast ASNs or CIDRs (one per line) used to set is_anycast")
+	asnCountryPath := flag.String("asn-country", "", "CSV file of ASN registrations: asn,rir,country")
+	moasPath := flag.String("moas", "", "CAIDA Routeviews prefix2as file (prefix, length, ASNs joined by _ or ,; optionally .gz) listing all origin ASNs in asns")
+	asRelationshipsPath := flag.String("as-relationships", "", "CAIDA AS relationships file (as1|as2|rel, optionally .bz2) used to fill asn_upstreams/asn_peers")
+	flag.Int64Var(&breakerThreshold, "breaker-threshold", 5, "Consecutive reader errors before a database is marked unhealthy (0 disables)")
+	flag.BoolVar(&breakerCacheOnly, "breaker-cache-only", false, "Serve only cached results while a database is unhealthy")
+	flag.BoolVar(&reloadCacheOnly, "reload-cache-only", false, "Serve only cached results while databases are being reloaded")
+	flag.Float64Var(&reloadMaxNodeDrop, "reload-max-node-drop", reloadMaxNodeDrop, "Refuse a reloaded mmdb whose search tree node count dropped by more than this percent (0 disables); older builds are always refused")
+	flag.DurationVar(&lookupTimeout, "lookup-timeout", 0, "Deadline for a database lookup on cache miss before answering 503 (0 disables)")
+	flag.IntVar(&rangeMinBits, "range-min-prefix", rangeMinBits, "Shortest IPv4 prefix length accepted by /api/range (bounds the walk)")
+	flag.IntVar(&rangeMinBits6, "range-min-prefix6", rangeMinBits6, "Shortest IPv6 prefix length accepted by /api/range")
+	buildIndex := flag.Bool("asn-index", false, "Build an ASN to prefixes index from the ASN mmdb at startup (memory heavy)")
+	buildOrgs := flag.Bool("org-index", false, "Build an organization name to prefixes index from the ASN and ISP mmdbs for /api/search (memory heavy, requires -admin-token)")
 	showVersion := flag.Bool("v", false, "Show version")
 	flag.Parse()
 
 	if *showVersion {
-		fmt.Printf("Version: %s\nCommit: %s\n", Version, CurrentCommit)
+		fmt.Printf("Version: %s\nCommit: %s\nBuild date: %s\nGo: %s\n", Version, CurrentCommit, BuildDate, runtime.Version())
 		return
 	}
 
-	multiWriter := io.MultiWriter(os.Stdout, &lumberjack.Logger{
-		Filename:   *logPath,
-		MaxSize:    *logSize,
-		MaxBackups: *logBackups,
-		MaxAge:     *logAge,
-		Compress:   true,
-	})
+	if err := setTrustedProxies(*trustedProxyList); err != nil {
+		log.Fatalf("Invalid -trusted-proxies: %v", err)
+	}
+	if !validForwardedHeader(forwardedHeader) {
+		log.Fatalf("Invalid -forwarded-header %q: must be auto, xff or forwarded", forwardedHeader)
+	}
+	if trustAllProxies {
+		log.Printf("WARNING: -trust-all-proxies is enabled, X-Forwarded-For from any client is trusted and can be spoofed")
+	}
+	if _, unknown := parseFields(defaultFields); len(unknown) > 0 {
+		log.Fatalf("Invalid -fields: %s", unknownFieldsMessage(unknown))
+	}
+	if *fieldNamesPath != "" {
+		renames, err := loadFieldNames(*fieldNamesPath)
+		if err != nil {
+			log.Fatalf("Failed to load -field-names: %v", err)
+		}
+		fieldRenames = renames
+		log.Printf("Loaded %d field renames from %s", len(renames), *fieldNamesPath)
+	}
+	if !validTimestampFormat(timestampFormat) {
+		log.Fatalf("Invalid -timestamp-format %q: must be millis, unix or rfc3339", timestampFormat)
+	}
+	if len(tlsPorts) > 0 && (*tlsCert == "" || *tlsKey == "") {
+		log.Fatal("-tls-port requires -tls-cert and -tls-key")
+	}
+	// 由 systemd socket activation 启动时使用传入的 socket 代替 -port（FileDescriptorName=https 的代替 -tls-port）
+	var activated, activatedTLS []net.Listener
+	sdListeners, sdNames, sdErr := systemdListeners()
+	if sdErr != nil {
+		log.Fatalf("Invalid systemd socket activation: %v", sdErr)
+	}
+	for i, ln := range sdListeners {
+		if sdNames[i] == "https" {
+			activatedTLS = append(activatedTLS, ln)
+		} else {
+			activated = append(activated, ln)
+		}
+	}
+	if len(activatedTLS) > 0 && (*tlsCert == "" || *tlsKey == "") {
+		log.Fatal("systemd https socket requires -tls-cert and -tls-key")
+	}
+	if len(ports) == 0 && len(tlsPorts) == 0 && len(sdListeners) == 0 {
+		ports = listFlag{":8399"}
+	}
+
+	// -log "" 或 -log - 时只输出到 stdout，不创建日志文件（适合容器环境）
+	var multiWriter io.Writer = os.Stdout
+	if *logPath != "" && *logPath != "-" {
+		multiWriter = io.MultiWriter(os.Stdout, &lumberjack.Logger{
+			Filename:   *logPath,
+			MaxSize:    *logSize,
+			MaxBackups: *logBackups,
+			MaxAge:     *logAge,
+			Compress:   true,
+		})
+	}
 	gin.DefaultWriter = multiWriter
+	log.Printf("Starting geoip-server %s (commit %s, built %s, %s)", Version, CurrentCommit, BuildDate, runtime.Version())
 
-	geoCache = lru.New(*cacheSize)
+	switch {
+	case *cacheBytesLimit > 0:
+		geoCache = newByteGeoCache(*cacheBytesLimit)
+	case *cacheSize > 0:
+		geoCache = newGeoCache(*cacheSize)
+	}
+	if *refreshAhead > 0 && (*cacheTTLFlag <= 0 || *refreshAhead >= *cacheTTLFlag) {
+		log.Fatal("-cache-refresh-ahead requires -cache-ttl longer than the refresh window")
+	}
+	setCacheRefresh(*cacheTTLFlag, *refreshAhead, *refreshWorkers)
+	if *respCacheSize > 0 {
+		respCache = newResponseCache(*respCacheSize, *respCacheTTL)
+	}
+	topIPs = newTopCounter(max(*topCapacity, 1))
+	slowRequests = newSlowTracker(max(*slowCapacity, 1), *slowWindow)
 
 	var err error
-	countryDB, err = geoip2.Open(*cityMMDBPath)
+	// 远端数据库在启动时下载到 -db-cache-dir，之后（含 SIGHUP 热加载）按本地文件处理
+	if isRemoteDBPath(*cityMMDBPath) || isRemoteDBPath(*asnMMDBPath) || isRemoteDBPath(*ispMMDBPath) {
+		cfg := downloadConfig{timeout: *downloadTimeout, proxy: *downloadProxy, retries: max(*downloadRetries, 0), backoff: time.Second}
+		client, err := newDownloadClient(cfg)
+		if err != nil {
+			log.Fatalf("Invalid -download-proxy: %v", err)
+		}
+		remote := &remoteDB{client: client, cfg: cfg, dir: *dbCacheDir, now: time.Now}
+		for _, p := range []*string{cityMMDBPath, asnMMDBPath, ispMMDBPath} {
+			if !isRemoteDBPath(*p) {
+				continue
+			}
+			if *p, err = remote.fetch(context.Background(), *p); err != nil {
+				log.Fatalf("Failed to download mmdb: %v", err)
+			}
+		}
+	}
+	countryDBPath, asnDBPath, ispDBPath = *cityMMDBPath, *asnMMDBPath, *ispMMDBPath
+	defer closeDatabases()
+
+	countryDB, err = openMMDB(*cityMMDBPath)
 	if err != nil {
-		log.Fatalf("Failed to open city mmdb: %v", err)
+		if *requireAllDBs {
+			log.Fatalf("Failed to open city mmdb: %v", err)
+		}
+		log.Printf("WARNING: failed to open city mmdb, serving without country data: %v", err)
+		countryDB = nil
+	} else {
+		countryDBEnterprise = isEnterpriseDB(countryDB)
 	}
-	defer countryDB.Close()
 
-	asnDB, err = geoip2.Open(*asnMMDBPath)
+	asnDB, err = openMMDB(*asnMMDBPath)
 	if err != nil {
-		log.Fatalf("Failed to open ASN mmdb: %v", err)
+		if *requireAllDBs {
+			log.Fatalf("Failed to open ASN mmdb: %v", err)
+		}
+		log.Printf("WARNING: failed to open ASN mmdb, serving without ASN data: %v", err)
+		asnDB = nil
 	}
-	defer asnDB.Close()
 
-	r := gin.New()
+	if cityFallbacks, err = openFallbacks(cityFallbackPaths); err != nil {
+		log.Fatalf("Failed to open city fallback mmdb: %v", err)
+	}
+	if asnFallbacks, err = openFallbacks(asnFallbackPaths); err != nil {
+		log.Fatalf("Failed to open ASN fallback mmdb: %v", err)
+	}
+	if compareDBPath != "" {
+		if compareDB, err = openMMDB(compareDBPath); err != nil {
+			log.Fatalf("Failed to open compare city mmdb: %v", err)
+		}
+		log.Printf("Opened compare city mmdb %s", compareDBPath)
+	}
+	if *archiveDir != "" {
+		if archives, err = newDBArchive(*archiveDir, max(*archiveReaders, 1)); err != nil {
+			log.Fatalf("Failed to scan -archive-dir: %v", err)
+		}
+		log.Printf("Found %d archived city and %d archived ASN databases in %s", len(archives.city), len(archives.asn), *archiveDir)
+	}
 
-	// Custom logger formatter
-	r.Use(gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
-		requestID, _ := param.Keys["RequestID"].(string)
-		return fmt.Sprintf("[%s] %s - [%s] \"%s %s %s\" %d %d \"%s\" \"%s\" \"%s\" \"%s\" \"%s\"\n",
-			param.TimeStamp.Format(time.RFC3339),
-			param.ClientIP,
-			requestID,
-			param.Method,
-			param.Path,
-			param.Request.Proto,
-			param.StatusCode,
-			param.Latency.Microseconds(),
-			param.Request.Host,
-			param.Request.UserAgent(),
-			param.Request.Header.Get("X-Forwarded-For"),
-			param.Request.Header.Get("X-Real-IP"),
-			param.Request.RemoteAddr,
-		)
-	}), gin.Recovery())
+	if countryDB == nil && asnDB == nil && len(cityFallbacks) == 0 && len(asnFallbacks) == 0 {
+		log.Fatal("No database could be opened")
+	}
+
+	if *ispMMDBPath != "" {
+		ispDB, err = openMMDB(*ispMMDBPath)
+		if err != nil {
+			log.Fatalf("Failed to open ISP mmdb: %v", err)
+		}
+		ispDBEnterprise = isEnterpriseDB(ispDB)
+	}
+
+	if *overridesPath != "" {
+		n, err := reloadOverrides(*overridesPath)
+		if err != nil {
+			log.Fatalf("Failed to load overrides: %v", err)
+		}
+		log.Printf("Loaded %d overrides from %s", n, *overridesPath)
+	}
+
+	if *hostingASNsPath != "" {
+		n, err := reloadHostingASNs(*hostingASNsPath)
+		if err != nil {
+			log.Fatalf("Failed to load hosting ASNs: %v", err)
+		}
+		log.Printf("Loaded %d hosting ASNs from %s", n, *hostingASNsPath)
+	}
+
+	if *anycastListPath != "" {
+		n, err := reloadAnycastList(*anycastListPath)
+		if err != nil {
+			log.Fatalf("Failed to load anycast list: %v", err)
+		}
+		log.Printf("Loaded %d anycast entries from %s", n, *anycastListPath)
+	}
+
+	if *asnCountryPath != "" {
+		asnRegistry, err = loadASNRegistry(*asnCountryPath)
+		if err != nil {
+			log.Fatalf("Failed to load ASN registrations: %v", err)
+		}
+		log.Printf("Loaded %d ASN registrations from %s", len(asnRegistry), *asnCountryPath)
+	}
+
+	if *asRelationshipsPath != "" {
+		asnRelationships, err = loadASRelationships(*asRelationshipsPath)
+		if err != nil {
+			log.Fatalf("Failed to load AS relationships: %v", err)
+		}
+		log.Printf("Loaded AS relationships for %d ASNs from %s", len(asnRelationships), *asRelationshipsPath)
+	}
+
+	if *moasPath != "" {
+		moasOrigins, err = loadMOAS(*moasPath)
+		if err != nil {
+			log.Fatalf("Failed to load MOAS data: %v", err)
+		}
+		log.Printf("Loaded %d prefixes for multi-origin ASNs from %s", len(moasOrigins.byPrefix), *moasPath)
+	}
+
+	if *buildIndex && asnDB != nil {
+		asnIndex, err = buildASNIndex(*asnMMDBPath)
+		if err != nil {
+			log.Fatalf("Failed to build ASN index: %v", err)
+		}
+	}
+	if *buildOrgs {
+		if adminToken == "" {
+			log.Fatal("-org-index requires -admin-token")
+		}
+		// 只索引成功打开的库，降级模式下缺少的库跳过
+		var asnPath, ispPath string
+		if asnDB != nil {
+			asnPath = *asnMMDBPath
+		}
+		if ispDB != nil {
+			ispPath = ispDBPath
+		}
+		orgIndex, err = buildOrgIndex(asnPath, ispPath)
+		if err != nil {
+			log.Fatalf("Failed to build organization index: %v", err)
+		}
+		log.Printf("Built organization index: %d names", len(orgIndex))
+	}
+
+	if err := setRequestIDFormat(*requestIDFormat); err != nil {
+		log.Fatalf("Invalid -request-id-format: %v", err)
+	}
+	deny, err := parseDenyList(*denyCountries, *denyASNs)
+	if err != nil {
+		log.Fatalf("Invalid deny list: %v", err)
+	}
+	if len(denyGroups) == 0 {
+		denyGroups = listFlag{"api"}
+	}
+	for _, g := range denyGroups {
+		if g != "api" && g != "admin" && g != "ui" {
+			log.Fatalf("Invalid -deny-groups %q: must be api, admin or ui", g)
+		}
+	}
+	// denyFor 返回挂载到指定路由组的拒绝中间件，未配置名单或该组不受限时为空
+	denyFor := func(group string) []gin.HandlerFunc {
+		if deny == nil || !slices.Contains(denyGroups, group) {
+			return nil
+		}
+		return []gin.HandlerFunc{denyMiddleware(deny)}
+	}
 
-	r.Use(requestIDMiddleware())
+	r := newRouter(*accessLog, *slowThreshold)
+	if *maxConcurrent > 0 {
+		r.Use(concurrencyLimiter(*maxConcurrent))
+	}
+	if *compressMinBytes > 0 {
+		r.Use(compressMiddleware(*compressMinBytes))
+	}
+	r.GET("/metrics", metricsHandler())
+	r.GET("/healthz", healthzHandler)
+	r.GET("/readyz", readyzHandler)
+	r.GET("/openapi.json", openAPIHandler)
+	r.GET("/version", versionHandler)
+	r.GET("/ip", ipHandler)
+
+	if *enableUI {
+		r.GET("/", append(denyFor("ui"), uiHandler)...)
+	}
 
-	api := r.Group("/api")
+	api := r.Group("/api", denyFor("api")...)
 	api.GET("/ipinfo", geoHandler)
-	r.Run(*port)
+	api.GET("/country", countryHandler)
+	api.GET("/asn/:asn", asnHandler)
+	api.GET("/range", rangeHandler)
+	api.POST("/lookup", maxBody(maxBodyBytes), lookupHandler)
+	api.GET("/stats", statsHandler)
+	api.GET("/metrics.json", metricsJSONHandler)
+
+	if adminToken != "" {
+		debug := api.Group("", adminAuth(adminToken))
+		debug.GET("/raw", rawHandler)
+		debug.GET("/export", exportHandler)
+		debug.GET("/walk", walkHandler)
+		debug.GET("/selftest", selftestHandler)
+		debug.GET("/compare", compareHandler)
+		debug.GET("/top", topHandler)
+		debug.GET("/search", orgSearchHandler)
+		debug.GET("/slow", slowHandler)
+
+		admin := r.Group("/admin", append(denyFor("admin"), adminAuth(adminToken))...)
+		admin.POST("/cache/resize", maxBody(maxBodyBytes), cacheResizeHandler)
+	}
+
+	if *cacheSnapshotPath != "" && geoCache != nil {
+		restoreCacheSnapshot(*cacheSnapshotPath, *cacheSnapshotTTL)
+	}
+	if *warmFile != "" {
+		warmCache(*warmFile)
+	}
+
+	go handleReload(reloadConfig{overridesPath: *overridesPath, hostingASNsPath: *hostingASNsPath, anycastListPath: *anycastListPath})
+	go handleDump(multiWriter)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *cacheReport > 0 && geoCache != nil {
+		go reportCache(ctx, *cacheReport)
+	}
+	if *sloWebhook != "" && *sloWindow > 0 {
+		go newSLOMonitor(*sloWebhook, *sloP99, *sloWindow, *sloCooldown).run(ctx)
+	}
+
+	// 仅在设置了 OTEL_EXPORTER_OTLP_ENDPOINT 等环境变量时启用追踪
+	shutdownTracing, err := setupTracing(ctx)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+	if tracingEnabled {
+		log.Printf("OpenTelemetry tracing enabled")
+	}
+
+	err = serve(ctx, r, serverConfig{
+		addrs:    ports,
+		tlsAddrs: tlsPorts,
+		certFile: *tlsCert,
+		keyFile:  *tlsKey,
+		h2c:      *enableH2C,
+		portFile: *portFile,
+
+		listeners:    activated,
+		tlsListeners: activatedTLS,
+
+		readTimeout:       *readTimeout,
+		readHeaderTimeout: *readHeaderTimeout,
+		writeTimeout:      *writeTimeout,
+		idleTimeout:       *idleTimeout,
+	})
+	flushCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	if terr := shutdownTracing(flushCtx); terr != nil {
+		log.Printf("Failed to flush traces: %v", terr)
+	}
+	cancel()
+	// 服务已停止，不再有请求写入缓存
+	if *cacheSnapshotPath != "" && geoCache != nil {
+		if n, serr := saveCacheSnapshot(*cacheSnapshotPath); serr != nil {
+			log.Printf("Failed to save cache snapshot: %v", serr)
+		} else {
+			log.Printf("Saved %d cache entries to %s", n, *cacheSnapshotPath)
+		}
+	}
+	if err != nil {
+		log.Fatalf("Server error: %v", err)
+	}
 }
@@ -8,8 +8,12 @@ GeoIP Server 性能测试
 
 运行特定测试:
   go test -bench=BenchmarkQueryGeo -benchmem
+  go test -bench='BenchmarkQueryGeo(WithCache|NoCache)' -benchmem
+  go test -bench='BenchmarkQueryGeo(CountryOnly)?NoCache' -benchmem
   go test -bench=BenchmarkGeoHandler -benchmem
   go test -bench=BenchmarkCachePerformance -benchmem
+  go test -bench=BenchmarkBatchLookup -benchmem
+  go test -bench=BenchmarkQueryGeoColdConcurrent -benchmem
 
 生成性能分析文件:
   go test -bench=. -benchmem -cpuprofile=cpu.prof -memprofile=mem.prof
@@ -25,11 +29,14 @@ GeoIP Server 性能测试
 */
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/netip"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/gin-gonic/gin"
@@ -77,7 +84,7 @@ func BenchmarkQueryGeo(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, _, err := queryGeo(ip)
+		_, err := queryGeo(ip)
 		if err != nil {
 			b.Fatalf("queryGeo failed: %v", err)
 		}
@@ -95,7 +102,24 @@ func BenchmarkQueryGeoWithCache(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, _, err := queryGeo(ip)
+		_, err := queryGeo(ip)
+		if err != nil {
+			b.Fatalf("queryGeo failed: %v", err)
+		}
+	}
+}
+
+// BenchmarkQueryGeoNoCache 测试关闭缓存（-cache 0）时直接查询数据库的性能
+func BenchmarkQueryGeoNoCache(b *testing.B) {
+	setupTest(b)
+	defer teardownTest(b)
+
+	geoCache = nil
+	ip, _ := netip.ParseAddr("8.8.8.8")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := queryGeo(ip)
 		if err != nil {
 			b.Fatalf("queryGeo failed: %v", err)
 		}
@@ -123,13 +147,60 @@ func BenchmarkQueryGeoMultipleIPs(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		ip := parsedIPs[i%len(parsedIPs)]
-		_, _, err := queryGeo(ip)
+		_, err := queryGeo(ip)
 		if err != nil {
 			b.Fatalf("queryGeo failed: %v", err)
 		}
 	}
 }
 
+// BenchmarkQueryGeoColdConcurrent 测试缓存未命中时大量并发请求同一 IP 的开销，
+// singleflight 合并后每轮只查一次库
+func BenchmarkQueryGeoColdConcurrent(b *testing.B) {
+	setupTest(b)
+	defer teardownTest(b)
+
+	const concurrency = 64
+	ip := netip.MustParseAddr("8.8.8.8")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		geoCache.Clear()
+		var wg sync.WaitGroup
+		wg.Add(concurrency)
+		for range concurrency {
+			go func() {
+				defer wg.Done()
+				if _, err := queryGeo(ip); err != nil {
+					b.Errorf("queryGeo failed: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+// BenchmarkBatchLookup 测试批量查询在不同并发数下的吞吐量
+func BenchmarkBatchLookup(b *testing.B) {
+	setupTest(b)
+	defer teardownTest(b)
+
+	lines := make([]string, lookupFlushEvery)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("%d.%d.%d.%d", 1+i%223, i*7%256, i*13%256, i%254+1)
+	}
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				// 清空缓存，测量实际数据库查询的并发扩展性
+				geoCache = lru.New(10000)
+				lookupRows(lines, workers)
+			}
+		})
+	}
+}
+
 // BenchmarkGetRealIP 测试 getRealIP 函数的性能
 func BenchmarkGetRealIP(b *testing.B) {
 	gin.SetMode(gin.ReleaseMode)
@@ -149,7 +220,7 @@ func BenchmarkGetRealIP(b *testing.B) {
 			w := httptest.NewRecorder()
 			c, _ := gin.CreateTestContext(w)
 			c.Request, _ = http.NewRequest("GET", "/", nil)
-			c.Request.RemoteAddr = "203.0.113.1:12345"
+			c.Request.RemoteAddr = "10.0.0.1:12345"
 			if tc.xff != "" {
 				c.Request.Header.Set("X-Forwarded-For", tc.xff)
 			}
@@ -277,3 +348,338 @@ func BenchmarkCachePerformance(b *testing.B) {
 		}
 	})
 }
+
+// TestRequestIDMiddleware 测试 X-Request-ID 的透传与清洗
+func TestRequestIDMiddleware(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(requestIDMiddleware())
+	r.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("RequestID"))
+	})
+
+	testCases := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{"Missing", "", false},
+		{"Valid", "abc-123", true},
+		{"TooLong", strings.Repeat("a", maxRequestIDLength+1), false},
+		{"CRLF", "abc\r\nforged log line", false},
+		{"Control", "abc\x00", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/", nil)
+			if tc.incoming != "" {
+				req.Header["X-Request-Id"] = []string{tc.incoming}
+			}
+			r.ServeHTTP(w, req)
+
+			got := w.Header().Get("X-Request-ID")
+			if got == "" || got != w.Body.String() {
+				t.Fatalf("request ID not propagated: header %q, body %q", got, w.Body.String())
+			}
+			if tc.keep && got != tc.incoming {
+				t.Errorf("expected incoming ID to be kept, got %q", got)
+			}
+			if !tc.keep && got == tc.incoming {
+				t.Errorf("expected a fresh ID, got %q", got)
+			}
+		})
+	}
+}
+
+// 访问日志必须带上请求 ID，包括未匹配路由的 404 与 405
+func TestAccessLogRequestID(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	var buf bytes.Buffer
+	orig := gin.DefaultWriter
+	gin.DefaultWriter = &buf
+	defer func() { gin.DefaultWriter = orig }()
+
+	r := newRouter(true, 0)
+	r.GET("/ok", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, tc := range []struct {
+		method, path string
+		code         int
+	}{
+		{"GET", "/ok", http.StatusOK},
+		{"GET", "/no-such-route", http.StatusNotFound},
+		{"POST", "/ok", http.StatusMethodNotAllowed},
+	} {
+		buf.Reset()
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(tc.method, tc.path, nil)
+		r.ServeHTTP(w, req)
+		if w.Code != tc.code {
+			t.Fatalf("%s %s status = %d, want %d", tc.method, tc.path, w.Code, tc.code)
+		}
+		id := w.Header().Get("X-Request-ID")
+		if id == "" {
+			t.Fatalf("%s %s: no X-Request-ID header", tc.method, tc.path)
+		}
+		if line := buf.String(); !strings.Contains(line, "- ["+id+"] ") {
+			t.Errorf("%s %s: access log %q lacks request ID %s", tc.method, tc.path, line, id)
+		}
+	}
+}
+
+func TestNewGeoResponseASNString(t *testing.T) {
+	ip := netip.MustParseAddr("8.8.8.8")
+	res := newGeoResponse(ip, &geoCacheEntry{country: &geoip2.City{}, asn: &geoip2.ASN{AutonomousSystemNumber: 15169}})
+	if res.ASN != 15169 || res.ASNString != "AS15169" {
+		t.Errorf("asn = %d, asn_string = %q", res.ASN, res.ASNString)
+	}
+	if res := newGeoResponse(ip, &geoCacheEntry{country: &geoip2.City{}}); res.ASNString != "" {
+		t.Errorf("asn_string without ASN = %q", res.ASNString)
+	}
+}
+
+// BenchmarkQueryGeoCountryOnlyNoCache 与 BenchmarkQueryGeoNoCache 对比 ?asn=false 省掉的 ASN 查询开销
+func BenchmarkQueryGeoCountryOnlyNoCache(b *testing.B) {
+	setupTest(b)
+	defer teardownTest(b)
+
+	geoCache = nil
+	ip, _ := netip.ParseAddr("8.8.8.8")
+	opts := lookupOptions{skipASN: true}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := queryGeoWith(ip, opts)
+		if err != nil {
+			b.Fatalf("queryGeoWith failed: %v", err)
+		}
+	}
+}
+
+func TestQueryGeoSkipASNCache(t *testing.T) {
+	orig := geoCache
+	geoCache = newGeoCache(10)
+	defer func() { geoCache = orig }()
+
+	ip := netip.MustParseAddr("203.0.113.7")
+	entry, err := queryGeoWith(ip, lookupOptions{skipASN: true})
+	if err != nil || !entry.asnSkipped {
+		t.Fatalf("country-only lookup = %+v, %v", entry, err)
+	}
+
+	// 需要 ASN 的请求不能使用只查了国家的缓存记录
+	misses := cacheMisses.Load()
+	entry, err = queryGeo(ip)
+	if err != nil || entry.asnSkipped {
+		t.Fatalf("full lookup = %+v, %v", entry, err)
+	}
+	if cacheMisses.Load() != misses+1 {
+		t.Error("country-only cache entry should count as a miss for a full lookup")
+	}
+
+	// 完整记录可服务只查国家的请求，且返回时去掉 ASN、不修改缓存对象
+	entry.asn = &geoip2.ASN{AutonomousSystemNumber: 64500}
+	stripped, err := queryGeoWith(ip, lookupOptions{skipASN: true})
+	if err != nil || stripped.asn != nil {
+		t.Fatalf("country-only hit = %+v, %v", stripped, err)
+	}
+	if cached, _ := cacheGet(ip); cached.asn == nil {
+		t.Error("cached entry was modified")
+	}
+}
+
+func TestQueryGeoNoCache(t *testing.T) {
+	orig := geoCache
+	geoCache = newGeoCache(10)
+	defer func() { geoCache = orig }()
+
+	ip := netip.MustParseAddr("203.0.113.8")
+	stale := &geoCacheEntry{country: &geoip2.City{}}
+	stale.country.Country.ISOCode = "ZZ"
+	geoCache.Add(ip.String(), stale)
+
+	hits := cacheHits.Load()
+	entry, err := queryGeoWith(ip, lookupOptions{noCache: true})
+	if err != nil || entry == stale {
+		t.Fatalf("nocache lookup returned the cached entry: %+v, %v", entry, err)
+	}
+	if cacheHits.Load() != hits {
+		t.Error("nocache lookup should not count as a cache hit")
+	}
+	// 新查到的记录写回缓存
+	if cached, _ := cacheGet(ip); cached == stale {
+		t.Error("nocache lookup should refresh the cached entry")
+	}
+}
+
+func TestLookupAndCacheASNFailure(t *testing.T) {
+	orig := geoCache
+	geoCache = newGeoCache(10)
+	defer func() { geoCache = orig }()
+
+	path := writeTestMMDB(t, "GeoLite2-City", map[string]any{
+		"203.0.113.0/24": map[string]any{"country": map[string]any{"iso_code": "JP"}},
+	})
+	var err error
+	if countryDB, err = openMMDB(path); err != nil {
+		t.Fatal(err)
+	}
+	// 把城市库当作 ASN 库使用，ASN() 返回 InvalidMethodError，模拟 ASN 库查询出错
+	asnDB = countryDB
+	defer func() {
+		countryDB.Close()
+		countryDB, asnDB = nil, nil
+		asnHealth.reset()
+	}()
+
+	ip := netip.MustParseAddr("203.0.113.9")
+	entry, err := lookupAndCache(ip, lookupOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !entry.asnFailed || entry.asn != nil || entry.country.Country.ISOCode != "JP" {
+		t.Errorf("entry = %+v, want city data without ASN", entry)
+	}
+	// 临时故障的结果不写入缓存，下次查询会重试 ASN 库
+	if cached, ok := cacheGet(ip); ok {
+		t.Errorf("entry with a failed ASN lookup was cached: %+v", cached)
+	}
+	if geoCache.Len() != 0 {
+		t.Errorf("cache has %d entries, want 0", geoCache.Len())
+	}
+}
+
+func TestGeoHandlerNoCacheAuth(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	adminToken = "secret"
+	defer func() { adminToken = "" }()
+	r := gin.New()
+	r.Use(requestIDMiddleware())
+	r.GET("/api/ipinfo", geoHandler)
+
+	for _, tc := range []struct {
+		token string
+		code  int
+	}{
+		{"", http.StatusUnauthorized},
+		{"wrong", http.StatusUnauthorized},
+		{"secret", http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/ipinfo?ip=127.0.0.1&nocache=true", nil)
+		if tc.token != "" {
+			req.Header.Set("X-API-Key", tc.token)
+		}
+		r.ServeHTTP(w, req)
+		if w.Code != tc.code {
+			t.Errorf("token %q: status = %d, want %d", tc.token, w.Code, tc.code)
+		}
+	}
+}
+
+func TestRawHandler(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(requestIDMiddleware())
+	r.GET("/api/raw", adminAuth("secret"), rawHandler)
+
+	get := func(query, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/raw?"+query, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, token := range []string{"", "wrong"} {
+		if w := get("ip=8.8.8.8", token); w.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: status = %d, want 401", token, w.Code)
+		}
+	}
+	if w := get("ip=8.8.8.8", "secret"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("without database: status = %d, want 503", w.Code)
+	}
+	for _, query := range []string{"ip=8.8.8.8&db=country", "ip=bogus"} {
+		if w := get(query, "secret"); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, w.Code)
+		}
+	}
+
+	path := writeTestMMDB(t, "GeoLite2-ASN", map[string]any{
+		"8.8.8.0/24": map[string]any{"autonomous_system_number": uint32(15169), "autonomous_system_organization": "GOOGLE"},
+	})
+	var err error
+	if asnDB, err = openMMDB(path); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		asnDB.Close()
+		asnDB = nil
+	}()
+
+	w := get("ip=8.8.8.8&db=asn", "secret")
+	var res struct {
+		ASN struct {
+			DatabaseType string     `json:"database_type"`
+			Record       geoip2.ASN `json:"record"`
+		} `json:"asn"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if w.Code != http.StatusOK || res.ASN.DatabaseType != "GeoLite2-ASN" || res.ASN.Record.AutonomousSystemNumber != 15169 {
+		t.Errorf("db=asn: status = %d, body = %s", w.Code, w.Body.String())
+	}
+	// 只查询指定的库，城市库未加载时返回 503
+	if w := get("ip=8.8.8.8&db=city", "secret"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("db=city without city database: status = %d, want 503", w.Code)
+	}
+}
+
+func TestResolutionOf(t *testing.T) {
+	city := &geoip2.City{}
+	city.Country.ISOCode = "DE"
+	city.City.Names.English = "Munich"
+	country := &geoip2.City{}
+	country.Country.ISOCode = "DE"
+
+	for want, record := range map[string]*geoip2.City{
+		resolutionCity:    city,
+		resolutionCountry: country,
+		resolutionNone:    {},
+	} {
+		if got := resolutionOf(record); got != want {
+			t.Errorf("resolutionOf(%+v) = %q, want %q", record.Country, got, want)
+		}
+	}
+}
+
+func TestGeoHandlerColo(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(requestIDMiddleware())
+	r.GET("/api/ipinfo", geoHandler)
+
+	for ray, want := range map[string]string{
+		"8f1c2a3b4d5e6f70-FRA": "FRA",
+		"abc":                  "", // 不含 "-" 的 Cf-Ray 不能导致 panic
+		"":                     "",
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/ipinfo?ip=127.0.0.1", nil)
+		if ray != "" {
+			req.Header.Set("Cf-Ray", ray)
+		}
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Cf-Ray %q: status = %d, want 200", ray, w.Code)
+		}
+		var res GeoResponse
+		json.Unmarshal(w.Body.Bytes(), &res)
+		if res.Colo != want {
+			t.Errorf("Cf-Ray %q: colo = %q, want %q", ray, res.Colo, want)
+		}
+	}
+}
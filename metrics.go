@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var httpResponses = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "geoip_http_responses_total",
+	Help: "HTTP responses by route path and status code.",
+}, []string{"path", "code"})
+
+// clientErrors、serverErrors 为 4xx、5xx 响应数，httpResponses 按标签拆分后不便直接汇总
+var (
+	clientErrors atomic.Uint64
+	serverErrors atomic.Uint64
+)
+
+func init() {
+	// 复用 /api/stats 的原子计数器，避免维护两套数据
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "geoip_cache_hits_total",
+		Help: "Record cache hits.",
+	}, func() float64 { return float64(cacheHits.Load()) })
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "geoip_cache_misses_total",
+		Help: "Record cache misses.",
+	}, func() float64 { return float64(cacheMisses.Load()) })
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "geoip_cache_evictions_total",
+		Help: "Record cache evictions, including resizes and reload clears.",
+	}, func() float64 { return float64(cacheEvictions.Load()) })
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "geoip_lookup_timeouts_total",
+		Help: "Database lookups abandoned after exceeding -lookup-timeout.",
+	}, func() float64 { return float64(lookupTimeouts.Load()) })
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "geoip_cache_refreshes_total",
+		Help: "Cache entries refreshed in the background before -cache-ttl expiry.",
+	}, func() float64 { return float64(cacheRefreshes.Load()) })
+}
+
+// metricsMiddleware 在 handler 执行完后按路由模板和状态码计数，
+// 使用 FullPath 而非原始 URL，避免标签基数随路径参数膨胀
+func metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		path := c.FullPath()
+		if path == "" {
+			path = "unmatched"
+		}
+		status := c.Writer.Status()
+		httpResponses.WithLabelValues(path, strconv.Itoa(status)).Inc()
+		switch {
+		case status >= 500:
+			serverErrors.Add(1)
+		case status >= 400:
+			clientErrors.Add(1)
+		}
+	}
+}
+
+func metricsHandler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
+
+type MetricsJSONResponse struct {
+	UptimeSeconds  int64   `json:"uptime_seconds"`
+	Requests       uint64  `json:"requests"`
+	ClientErrors   uint64  `json:"client_errors"`
+	ServerErrors   uint64  `json:"server_errors"`
+	CacheHits      uint64  `json:"cache_hits"`
+	CacheMisses    uint64  `json:"cache_misses"`
+	CacheEvictions uint64  `json:"cache_evictions"`
+	LookupTimeouts uint64  `json:"lookup_timeouts"`
+	LatencyP50Ms   float64 `json:"latency_p50_ms"`
+	LatencyP95Ms   float64 `json:"latency_p95_ms"`
+	LatencyP99Ms   float64 `json:"latency_p99_ms"`
+}
+
+// metricsJSONHandler 以 JSON 返回与 /metrics 相同的计数器，供不解析 Prometheus 文本格式的面板使用
+func metricsJSONHandler(c *gin.Context) {
+	p := requestLatency.percentiles(0.50, 0.95, 0.99)
+	c.JSON(http.StatusOK, MetricsJSONResponse{
+		UptimeSeconds:  int64(time.Since(startTime).Seconds()),
+		Requests:       requestsTotal.Load(),
+		ClientErrors:   clientErrors.Load(),
+		ServerErrors:   serverErrors.Load(),
+		CacheHits:      cacheHits.Load(),
+		CacheMisses:    cacheMisses.Load(),
+		CacheEvictions: cacheEvictions.Load(),
+		LookupTimeouts: lookupTimeouts.Load(),
+		LatencyP50Ms:   toMillis(p[0]),
+		LatencyP95Ms:   toMillis(p[1]),
+		LatencyP99Ms:   toMillis(p[2]),
+	})
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMetricsJSON(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(statsMiddleware(), metricsMiddleware())
+	r.GET("/api/ipinfo", geoHandler)
+	r.GET("/api/metrics.json", metricsJSONHandler)
+
+	before := clientErrors.Load()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/ipinfo?ip=not-an-ip", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/metrics.json", nil))
+	var res MetricsJSONResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.ClientErrors != before+1 {
+		t.Errorf("client_errors = %d, want %d", res.ClientErrors, before+1)
+	}
+	if res.Requests == 0 {
+		t.Error("requests should include the previous lookup")
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+
+	"github.com/oschwald/geoip2-golang/v2"
+	"github.com/oschwald/maxminddb-golang/v2"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// readGzipMMDB 按文件头魔数识别 gzip 压缩的 mmdb（如 .mmdb.gz）并解压到内存；
+// 未压缩的文件返回 ok=false，由调用方继续使用 mmap 方式打开
+func readGzipMMDB(path string) (data []byte, ok bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	magic, err := br.Peek(len(gzipMagic))
+	if err != nil || !bytes.Equal(magic, gzipMagic) {
+		return nil, false, nil
+	}
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, false, err
+	}
+	defer zr.Close()
+	data, err = io.ReadAll(zr)
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// openMMDB 打开 geoip2 数据库，支持 gzip 压缩的文件
+func openMMDB(path string) (*geoip2.Reader, error) {
+	data, ok, err := readGzipMMDB(path)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return geoip2.OpenBytes(data)
+	}
+	return geoip2.Open(path)
+}
+
+// openRawMMDB 以 maxminddb 方式打开数据库，用于遍历网段，支持 gzip 压缩的文件
+func openRawMMDB(path string) (*maxminddb.Reader, error) {
+	data, ok, err := readGzipMMDB(path)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return maxminddb.OpenBytes(data)
+	}
+	return maxminddb.Open(path)
+}
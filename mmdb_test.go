@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"maps"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestReadGzipMMDB(t *testing.T) {
+	dir := t.TempDir()
+	payload := []byte("not really an mmdb, but enough to check decompression")
+
+	plain := filepath.Join(dir, "plain.mmdb")
+	if err := os.WriteFile(plain, payload, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := readGzipMMDB(plain); ok || err != nil {
+		t.Errorf("plain file: ok=%v err=%v, want not gzip", ok, err)
+	}
+
+	// 按魔数而非扩展名识别
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(payload)
+	zw.Close()
+	compressed := filepath.Join(dir, "db.mmdb")
+	if err := os.WriteFile(compressed, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	data, ok, err := readGzipMMDB(compressed)
+	if err != nil || !ok || !bytes.Equal(data, payload) {
+		t.Errorf("gzip file: ok=%v err=%v data=%q", ok, err, data)
+	}
+
+	if _, err := openMMDB(compressed); err == nil {
+		t.Error("openMMDB should reject invalid database content")
+	}
+}
+
+// writeTestMMDB 按 MaxMind DB 格式生成只含 IPv4 网段的测试库，返回文件路径。
+// records 的 key 为互不重叠的 CIDR，值支持 map[string]any、[]any、string、bool、float64 及无符号整数
+func writeTestMMDB(t *testing.T, dbType string, records map[string]any) string {
+	t.Helper()
+
+	// 节点的子记录：>= 0 为节点下标，-1 为空，<= -2 为 data 中第 -(r+2) 个值
+	type node [2]int
+	nodes := []node{{-1, -1}}
+	var data bytes.Buffer
+	var offsets []int
+	for cidr, record := range records {
+		prefix := netip.MustParsePrefix(cidr).Masked()
+		if !prefix.Addr().Is4() {
+			t.Fatalf("writeTestMMDB: %s is not IPv4", cidr)
+		}
+		offsets = append(offsets, data.Len())
+		encodeMMDBValue(t, &data, record)
+
+		ip := prefix.Addr().As4()
+		n := 0
+		for i := range prefix.Bits() {
+			bit := int(ip[i/8]>>(7-i%8)) & 1
+			if i == prefix.Bits()-1 {
+				nodes[n][bit] = -(len(offsets) + 1)
+				break
+			}
+			if nodes[n][bit] < 0 {
+				if nodes[n][bit] != -1 {
+					t.Fatalf("writeTestMMDB: %s overlaps another network", cidr)
+				}
+				nodes = append(nodes, node{-1, -1})
+				nodes[n][bit] = len(nodes) - 1
+			}
+			n = nodes[n][bit]
+		}
+	}
+
+	var buf bytes.Buffer
+	count := len(nodes)
+	for _, n := range nodes {
+		for _, r := range n {
+			v := count
+			switch {
+			case r >= 0:
+				v = r
+			case r <= -2:
+				v = count + 16 + offsets[-r-2]
+			}
+			buf.Write([]byte{byte(v >> 16), byte(v >> 8), byte(v)})
+		}
+	}
+	buf.Write(make([]byte, 16))
+	buf.Write(data.Bytes())
+	buf.WriteString("\xab\xcd\xefMaxMind.com")
+	encodeMMDBValue(t, &buf, map[string]any{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1735603200),
+		"database_type":               dbType,
+		"description":                 map[string]any{"en": "test database"},
+		"ip_version":                  uint16(4),
+		"languages":                   []any{"en"},
+		"node_count":                  uint32(count),
+		"record_size":                 uint16(24),
+	})
+
+	path := filepath.Join(t.TempDir(), dbType+".mmdb")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func encodeMMDBValue(t *testing.T, buf *bytes.Buffer, v any) {
+	t.Helper()
+	writeControl := func(typ, size int) {
+		var ctrl byte
+		extended := -1
+		if typ > 7 {
+			extended = typ - 7
+		} else {
+			ctrl = byte(typ) << 5
+		}
+		var extra []byte
+		switch {
+		case size < 29:
+			ctrl |= byte(size)
+		case size < 285:
+			ctrl |= 29
+			extra = []byte{byte(size - 29)}
+		default:
+			ctrl |= 30
+			extra = []byte{byte((size - 285) >> 8), byte(size - 285)}
+		}
+		buf.WriteByte(ctrl)
+		if extended >= 0 {
+			buf.WriteByte(byte(extended))
+		}
+		buf.Write(extra)
+	}
+	writeUint := func(typ int, n uint64) {
+		var b []byte
+		for ; n > 0; n >>= 8 {
+			b = append([]byte{byte(n)}, b...)
+		}
+		writeControl(typ, len(b))
+		buf.Write(b)
+	}
+
+	switch v := v.(type) {
+	case string:
+		writeControl(2, len(v))
+		buf.WriteString(v)
+	case float64:
+		writeControl(3, 8)
+		binary.Write(buf, binary.BigEndian, v)
+	case uint16:
+		writeUint(5, uint64(v))
+	case uint32:
+		writeUint(6, uint64(v))
+	case uint:
+		writeUint(6, uint64(v))
+	case uint64:
+		writeUint(9, v)
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		writeControl(14, size)
+	case []any:
+		writeControl(11, len(v))
+		for _, e := range v {
+			encodeMMDBValue(t, buf, e)
+		}
+	case map[string]any:
+		writeControl(7, len(v))
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			encodeMMDBValue(t, buf, k)
+			encodeMMDBValue(t, buf, v[k])
+		}
+	default:
+		t.Fatalf("encodeMMDBValue: unsupported type %T", v)
+	}
+}
+
+func TestWriteTestMMDB(t *testing.T) {
+	path := writeTestMMDB(t, "GeoLite2-ASN", map[string]any{
+		"1.1.1.0/24": map[string]any{"autonomous_system_number": uint32(13335), "autonomous_system_organization": "CLOUDFLARENET"},
+		"8.8.8.0/24": map[string]any{"autonomous_system_number": uint32(15169), "autonomous_system_organization": "GOOGLE"},
+	})
+	db, err := openMMDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	record, err := db.ASN(netip.MustParseAddr("8.8.8.8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.AutonomousSystemNumber != 15169 || record.AutonomousSystemOrganization != "GOOGLE" || record.Network.String() != "8.8.8.0/24" {
+		t.Errorf("8.8.8.8 = %+v", record)
+	}
+	if record, err := db.ASN(netip.MustParseAddr("9.9.9.9")); err != nil || record.HasData() {
+		t.Errorf("9.9.9.9 = %+v, %v", record, err)
+	}
+}
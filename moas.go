@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// moasTable 为 -moas 加载的网段 → 起源 ASN，按前缀长度分组以便最长前缀匹配。
+// 只保留多起源（MOAS）网段及其内部更具体的网段：后者的起源覆盖外层的 MOAS
+type moasTable struct {
+	byPrefix map[netip.Prefix][]uint // 单一起源的更具体网段值为 nil
+	lengths4 []int                   // 出现过的 IPv4 前缀长度，从长到短
+	lengths6 []int
+}
+
+var moasOrigins *moasTable
+
+// loadMOAS 读取 CAIDA Routeviews prefix2as 格式：<网段>\t<前缀长度>\t<ASN>，
+// 多个起源以 _ 分隔，AS set 以 , 分隔；# 开头为注释，.gz 后缀的文件自动解压
+func loadMOAS(path string) (*moasTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	all := make(map[netip.Prefix][]uint)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		parts := strings.Fields(text)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("line %d: expected prefix, length and ASN", line)
+		}
+		addr, err := netip.ParseAddr(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid prefix %q", line, parts[0])
+		}
+		bits, err := strconv.Atoi(parts[1])
+		if err != nil || bits < 0 || bits > addr.BitLen() {
+			return nil, fmt.Errorf("line %d: invalid prefix length %q", line, parts[1])
+		}
+		var origins []uint
+		for _, s := range strings.FieldsFunc(parts[2], func(r rune) bool { return r == '_' || r == ',' }) {
+			asn, err := parseASN(s)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid ASN %q", line, s)
+			}
+			origins = append(origins, asn)
+		}
+		prefix := netip.PrefixFrom(addr, bits).Masked()
+		origins = append(all[prefix], origins...)
+		slices.Sort(origins)
+		all[prefix] = slices.Compact(origins)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	t := &moasTable{byPrefix: make(map[netip.Prefix][]uint)}
+	for prefix, origins := range all {
+		if len(origins) > 1 {
+			t.byPrefix[prefix] = origins
+		}
+	}
+	for prefix, origins := range all {
+		if len(origins) <= 1 && t.insideMOAS(prefix) {
+			t.byPrefix[prefix] = nil
+		}
+	}
+	seen4, seen6 := map[int]bool{}, map[int]bool{}
+	for prefix := range t.byPrefix {
+		if prefix.Addr().Is4() && !seen4[prefix.Bits()] {
+			seen4[prefix.Bits()] = true
+			t.lengths4 = append(t.lengths4, prefix.Bits())
+		} else if prefix.Addr().Is6() && !seen6[prefix.Bits()] {
+			seen6[prefix.Bits()] = true
+			t.lengths6 = append(t.lengths6, prefix.Bits())
+		}
+	}
+	slices.SortFunc(t.lengths4, func(a, b int) int { return b - a })
+	slices.SortFunc(t.lengths6, func(a, b int) int { return b - a })
+	return t, nil
+}
+
+// insideMOAS 判断 prefix 是否位于某个多起源网段之内
+func (t *moasTable) insideMOAS(prefix netip.Prefix) bool {
+	for bits := prefix.Bits() - 1; bits >= 0; bits-- {
+		if origins := t.byPrefix[netip.PrefixFrom(prefix.Addr(), bits).Masked()]; len(origins) > 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// origins 按最长前缀匹配返回 ip 所在网段的起源 ASN，不是多起源网段时返回 nil
+func (t *moasTable) origins(ip netip.Addr) []uint {
+	ip = ip.Unmap()
+	lengths := t.lengths6
+	if ip.Is4() {
+		lengths = t.lengths4
+	}
+	for _, bits := range lengths {
+		if origins, ok := t.byPrefix[netip.PrefixFrom(ip, bits).Masked()]; ok {
+			return origins
+		}
+	}
+	return nil
+}
+
+// lookupASNs 返回 asns 字段：主 ASN 在前，其后为 -moas 中同一网段的其他起源 ASN（升序）；
+// 未加载数据或不是多起源网段时只有主 ASN
+func lookupASNs(ip netip.Addr, primary uint) []uint {
+	asns := []uint{primary}
+	if moasOrigins == nil {
+		return asns
+	}
+	for _, asn := range moasOrigins.origins(ip) {
+		if asn != primary {
+			asns = append(asns, asn)
+		}
+	}
+	return asns
+}
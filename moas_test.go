@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadMOAS(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routeviews-rv2-pfx2as.txt")
+	content := "# pfx2as\n" +
+		"203.0.113.0\t24\t64500_64501\n" +
+		"203.0.113.128\t25\t64502\n" +
+		"198.51.100.0\t24\t64510\n" +
+		"2001:db8::\t32\t64520,64521\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	table, err := loadMOAS(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 与多起源无关的单一起源网段不保留
+	if len(table.byPrefix) != 3 {
+		t.Errorf("loaded %d prefixes, want 3", len(table.byPrefix))
+	}
+	moasOrigins = table
+	defer func() { moasOrigins = nil }()
+
+	testCases := []struct {
+		ip      string
+		primary uint
+		want    []uint
+	}{
+		{"203.0.113.1", 64501, []uint{64501, 64500}},
+		{"::ffff:203.0.113.1", 64500, []uint{64500, 64501}},
+		{"203.0.113.200", 64502, []uint{64502}}, // 更具体的单一起源网段优先
+		{"198.51.100.1", 64510, []uint{64510}},
+		{"2001:db8::1", 64520, []uint{64520, 64521}},
+	}
+	for _, tc := range testCases {
+		if got := lookupASNs(netip.MustParseAddr(tc.ip), tc.primary); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("lookupASNs(%s) = %v, want %v", tc.ip, got, tc.want)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("203.0.113.0\t33\t64500\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadMOAS(path); err == nil {
+		t.Error("expected error for invalid prefix length")
+	}
+
+	moasOrigins = nil
+	if got := lookupASNs(netip.MustParseAddr("203.0.113.1"), 15169); !reflect.DeepEqual(got, []uint{15169}) {
+		t.Errorf("without -moas: %v", got)
+	}
+}
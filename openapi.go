@@ -0,0 +1,26 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// openAPISpec 描述对外 API，GeoResponse 字段由 openapi_test.go 校验与结构体保持一致
+//
+//go:embed web/openapi.json
+var openAPISpec []byte
+
+// openAPIHandler 按请求填充 servers，使生成的客户端在反向代理之后也指向对外地址
+func openAPIHandler(c *gin.Context) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		c.Data(http.StatusOK, "application/json; charset=utf-8", openAPISpec)
+		return
+	}
+	servers, _ := json.Marshal([]map[string]string{{"url": publicBaseURL(c)}})
+	doc["servers"] = servers
+	c.JSON(http.StatusOK, doc)
+}
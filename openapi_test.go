@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// TestOpenAPISchemaCoverage 保证 openapi.json 中的 schema 与响应结构体字段一一对应
+func TestOpenAPISchemaCoverage(t *testing.T) {
+	var spec struct {
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]json.RawMessage `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatalf("invalid openapi.json: %v", err)
+	}
+
+	for name, typ := range map[string]reflect.Type{
+		"GeoResponse":     reflect.TypeOf(GeoResponse{}),
+		"ASNResponse":     reflect.TypeOf(ASNResponse{}),
+		"ErrorResponse":   reflect.TypeOf(ErrorResponse{}),
+		"Subdivision":     reflect.TypeOf(Subdivision{}),
+		"ResponseSources": reflect.TypeOf(ResponseSources{}),
+		"DataSource":      reflect.TypeOf(DataSource{}),
+	} {
+		schema, ok := spec.Components.Schemas[name]
+		if !ok {
+			t.Errorf("schema %s missing", name)
+			continue
+		}
+		var want, got []string
+		for field := range jsonFieldIndex(typ) {
+			want = append(want, field)
+		}
+		for field := range schema.Properties {
+			got = append(got, field)
+		}
+		sort.Strings(want)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("schema %s properties = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"cmp"
+	"log"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	orgSearchMinQuery     = 2
+	orgSearchDefaultLimit = 100
+	orgSearchMaxLimit     = 1000
+)
+
+// orgIndex 由 -org-index 启动时遍历 ASN 库与 ISP 库构建，按名称排序，只读
+var orgIndex []orgEntry
+
+type orgEntry struct {
+	lower string // 小写的组织名，用于不区分大小写的子串匹配
+	match OrgMatch
+}
+
+type OrgMatch struct {
+	Organization string         `json:"organization"`
+	ASN          uint           `json:"asn,omitempty"`
+	Source       string         `json:"source"` // asn 或 isp
+	PrefixCount  int            `json:"prefix_count"`
+	Prefixes     []netip.Prefix `json:"prefixes"`
+}
+
+type OrgSearchResponse struct {
+	Query     string     `json:"query"`
+	Matches   []OrgMatch `json:"matches"`
+	Truncated bool       `json:"truncated,omitempty"`
+	RequestID string     `json:"request_id,omitempty"`
+}
+
+// buildOrgIndex 建立组织名 → 网段的索引：ASN 库按 ASN 分组（复用 -asn-index 的结果），
+// ISP 库按 isp 与 organization 名称分组；ispPath 为空时只索引 ASN 库
+func buildOrgIndex(asnPath, ispPath string) ([]orgEntry, error) {
+	byASN := asnIndex
+	if byASN == nil && asnPath != "" {
+		var err error
+		if byASN, err = buildASNIndex(asnPath); err != nil {
+			return nil, err
+		}
+	}
+	index := []orgEntry{}
+	for asn, info := range byASN {
+		if info.Organization == "" {
+			continue
+		}
+		index = append(index, newOrgEntry(OrgMatch{Organization: info.Organization, ASN: asn, Source: "asn", Prefixes: info.Prefixes}))
+	}
+
+	if ispPath != "" {
+		isp, err := buildISPOrgIndex(ispPath)
+		if err != nil {
+			return nil, err
+		}
+		index = append(index, isp...)
+	}
+
+	slices.SortFunc(index, func(a, b orgEntry) int {
+		return cmp.Or(cmp.Compare(a.lower, b.lower), cmp.Compare(a.match.Source, b.match.Source), cmp.Compare(a.match.ASN, b.match.ASN))
+	})
+	return index, nil
+}
+
+// buildISPOrgIndex 遍历 ISP 或 Enterprise 库，同一名称的网段合并为一条
+func buildISPOrgIndex(path string) ([]orgEntry, error) {
+	reader, err := openRawMMDB(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	start := time.Now()
+	byName := make(map[string]*OrgMatch)
+	add := func(name string, asn uint, prefix netip.Prefix) {
+		if name == "" {
+			return
+		}
+		m, ok := byName[name]
+		if !ok {
+			m = &OrgMatch{Organization: name, ASN: asn, Source: "isp"}
+			byName[name] = m
+		}
+		m.Prefixes = append(m.Prefixes, prefix)
+	}
+	for result := range reader.Networks() {
+		// ISP 库的字段位于顶层，Enterprise 库位于 traits 下
+		var record struct {
+			ISP          string `maxminddb:"isp"`
+			Organization string `maxminddb:"organization"`
+			Number       uint   `maxminddb:"autonomous_system_number"`
+			Traits       struct {
+				ISP          string `maxminddb:"isp"`
+				Organization string `maxminddb:"organization"`
+				Number       uint   `maxminddb:"autonomous_system_number"`
+			} `maxminddb:"traits"`
+		}
+		if err := result.Decode(&record); err != nil {
+			return nil, err
+		}
+		isp := cmp.Or(record.ISP, record.Traits.ISP)
+		org := cmp.Or(record.Organization, record.Traits.Organization)
+		asn := cmp.Or(record.Number, record.Traits.Number)
+		add(isp, asn, result.Prefix())
+		if org != isp {
+			add(org, asn, result.Prefix())
+		}
+	}
+
+	index := make([]orgEntry, 0, len(byName))
+	for _, m := range byName {
+		index = append(index, newOrgEntry(*m))
+	}
+	log.Printf("Built ISP organization index: %d names in %s", len(index), time.Since(start))
+	return index, nil
+}
+
+func newOrgEntry(m OrgMatch) orgEntry {
+	m.PrefixCount = len(m.Prefixes)
+	return orgEntry{lower: strings.ToLower(m.Organization), match: m}
+}
+
+// searchOrgs 返回名称包含 query（不区分大小写）的前 limit 条，以及是否还有更多结果
+func searchOrgs(index []orgEntry, query string, limit int) ([]OrgMatch, bool) {
+	query = strings.ToLower(query)
+	matches := []OrgMatch{}
+	for _, e := range index {
+		if !strings.Contains(e.lower, query) {
+			continue
+		}
+		if len(matches) == limit {
+			return matches, true
+		}
+		matches = append(matches, e.match)
+	}
+	return matches, false
+}
+
+// orgSearchHandler 按组织名子串查找已索引的网段。网段为 mmdb 中的记录划分，可能被拆分或合并
+func orgSearchHandler(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("org"))
+	if len([]rune(query)) < orgSearchMinQuery {
+		abortWithError(c, http.StatusBadRequest, ErrCodeInvalidParam, "org: must be at least 2 characters")
+		return
+	}
+	limit := orgSearchDefaultLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > orgSearchMaxLimit {
+			abortWithError(c, http.StatusBadRequest, ErrCodeInvalidParam, "limit: must be between 1 and 1000")
+			return
+		}
+		limit = n
+	}
+	if orgIndex == nil {
+		abortWithError(c, http.StatusServiceUnavailable, ErrCodeNoData, "Organization search needs -org-index")
+		return
+	}
+
+	matches, truncated := searchOrgs(orgIndex, query, limit)
+	requestID, _ := c.Get("RequestID")
+	id, _ := requestID.(string)
+	c.JSON(http.StatusOK, OrgSearchResponse{Query: query, Matches: matches, Truncated: truncated, RequestID: id})
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSearchOrgs(t *testing.T) {
+	asnIndex = map[uint]*asnInfo{
+		16509: {Organization: "AMAZON-02", Prefixes: []netip.Prefix{netip.MustParsePrefix("3.0.0.0/15")}},
+		14618: {Organization: "AMAZON-AES", Prefixes: []netip.Prefix{netip.MustParsePrefix("3.80.0.0/12")}},
+		15169: {Organization: "GOOGLE"},
+	}
+	defer func() { asnIndex = nil }()
+	index, err := buildOrgIndex("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matches, truncated := searchOrgs(index, "amazon", 10)
+	if len(matches) != 2 || truncated || matches[0].Organization != "AMAZON-02" || matches[0].PrefixCount != 1 {
+		t.Errorf("search amazon = %+v, truncated=%v", matches, truncated)
+	}
+	if matches, truncated := searchOrgs(index, "Amazon", 1); len(matches) != 1 || !truncated {
+		t.Errorf("limit 1 = %+v, truncated=%v", matches, truncated)
+	}
+	if matches, _ := searchOrgs(index, "cloudflare", 10); len(matches) != 0 {
+		t.Errorf("unexpected matches %+v", matches)
+	}
+}
+
+func TestOrgSearchHandlerParams(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.GET("/api/search", orgSearchHandler)
+
+	for url, want := range map[string]int{
+		"/api/search":                     http.StatusBadRequest,
+		"/api/search?org=a":               http.StatusBadRequest,
+		"/api/search?org=amazon&limit=0":  http.StatusBadRequest,
+		"/api/search?org=amazon":          http.StatusServiceUnavailable,
+		"/api/search?org=amazon&limit=10": http.StatusServiceUnavailable,
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != want {
+			t.Errorf("%s: status = %d, want %d", url, w.Code, want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/oschwald/geoip2-golang/v2"
+)
+
+type override struct {
+	prefix       netip.Prefix
+	countryCode  string
+	asn          uint
+	organization string
+}
+
+// overrides 按前缀长度降序排列，第一个命中即为最长前缀匹配
+var overrides atomic.Pointer[[]override]
+
+// loadOverrides 读取 CSV 格式的覆盖文件：cidr,country_code,asn,organization
+// 除 cidr 外均可留空，# 开头为注释
+func loadOverrides(path string) ([]override, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	var list []override
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := r.FieldPos(0)
+
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(rec[0]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		o := override{prefix: prefix.Masked()}
+		if len(rec) > 1 {
+			o.countryCode = strings.ToUpper(strings.TrimSpace(rec[1]))
+		}
+		if len(rec) > 2 && strings.TrimSpace(rec[2]) != "" {
+			asn, err := parseASN(rec[2])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid ASN %q", line, rec[2])
+			}
+			o.asn = asn
+		}
+		if len(rec) > 3 {
+			o.organization = strings.TrimSpace(strings.Join(rec[3:], ","))
+		}
+		list = append(list, o)
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].prefix.Bits() > list[j].prefix.Bits()
+	})
+	return list, nil
+}
+
+func lookupOverride(ip netip.Addr) *override {
+	list := overrides.Load()
+	if list == nil {
+		return nil
+	}
+	// IPv4 映射地址（如双栈 socket 上的 ::ffff:10.1.2.3）需还原为 IPv4 才能匹配 IPv4 网段
+	ip = ip.Unmap()
+	for i := range *list {
+		if (*list)[i].prefix.Contains(ip) {
+			return &(*list)[i]
+		}
+	}
+	return nil
+}
+
+func (o *override) cityRecord() *geoip2.City {
+	if o.countryCode == "" {
+		return nil
+	}
+	city := &geoip2.City{}
+	city.Country.ISOCode = o.countryCode
+	city.RegisteredCountry.ISOCode = o.countryCode
+	city.Traits.Network = o.prefix
+	return city
+}
+
+func (o *override) asnRecord() *geoip2.ASN {
+	if o.asn == 0 && o.organization == "" {
+		return nil
+	}
+	return &geoip2.ASN{
+		Network:                      o.prefix,
+		AutonomousSystemNumber:       o.asn,
+		AutonomousSystemOrganization: o.organization,
+	}
+}
+
+func reloadOverrides(path string) (int, error) {
+	list, err := loadOverrides(path)
+	if err != nil {
+		return 0, err
+	}
+	overrides.Store(&list)
+	return len(list), nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadOverridesLongestPrefix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overrides.csv")
+	content := `# cidr,country_code,asn,organization
+10.0.0.0/8,cn,64512,Internal
+10.1.0.0/16,us,,
+2001:db8::/32,,64513,"Anycast, Inc"
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reloadOverrides(path); err != nil {
+		t.Fatalf("reloadOverrides failed: %v", err)
+	}
+	defer overrides.Store(nil)
+
+	testCases := []struct {
+		ip      string
+		country string
+		asn     uint
+		org     string
+	}{
+		{"10.2.3.4", "CN", 64512, "Internal"},
+		{"10.1.2.3", "US", 0, ""},
+		{"::ffff:10.1.2.3", "US", 0, ""},
+		{"2001:db8::1", "", 64513, "Anycast, Inc"},
+	}
+	for _, tc := range testCases {
+		o := lookupOverride(netip.MustParseAddr(tc.ip))
+		if o == nil {
+			t.Fatalf("%s: expected override", tc.ip)
+		}
+		if o.countryCode != tc.country || o.asn != tc.asn || o.organization != tc.org {
+			t.Errorf("%s: got %+v", tc.ip, *o)
+		}
+	}
+
+	if o := lookupOverride(netip.MustParseAddr("192.0.2.1")); o != nil {
+		t.Errorf("192.0.2.1: unexpected override %+v", *o)
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 默认信任回环与私有地址段上的代理，与旧的"跳过内网地址"行为保持一致
+var defaultTrustedProxies = []string{
+	"127.0.0.0/8",
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"::1/128",
+	"fc00::/7",
+}
+
+var trustedProxies []netip.Prefix
+
+// trustAllProxies 为 true 时任何对端发来的 X-Forwarded-For 都会被采用，
+// 仅适用于服务只能经由受信任负载均衡访问的内网部署
+var trustAllProxies bool
+
+func init() {
+	setTrustedProxies(strings.Join(defaultTrustedProxies, ","))
+}
+
+func setTrustedProxies(list string) error {
+	var prefixes []netip.Prefix
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			// 也允许直接写单个 IP
+			addr, addrErr := netip.ParseAddr(s)
+			if addrErr != nil {
+				return err
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	trustedProxies = prefixes
+	return nil
+}
+
+func isTrustedProxy(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// 超过限制的 X-Forwarded-For / Forwarded 直接忽略，避免超长请求头在热路径上造成大量分配
+const (
+	maxXFFLength = 2048
+	maxXFFHops   = 20
+)
+
+// -forwarded-header 的取值：auto 时只有一种头就用该头，两者都有时采用 X-Forwarded-For
+// （通常说明代理只追加了 XFF、原样透传了客户端带来的 Forwarded）；代理写的是 Forwarded 时应显式指定 forwarded
+const (
+	forwardedHeaderAuto      = "auto"
+	forwardedHeaderXFF       = "xff"
+	forwardedHeaderForwarded = "forwarded"
+)
+
+var forwardedHeader = forwardedHeaderAuto
+
+func validForwardedHeader(v string) bool {
+	return v == forwardedHeaderAuto || v == forwardedHeaderXFF || v == forwardedHeaderForwarded
+}
+
+// getRealIP 仅在直连对端为受信任代理（或开启 -trust-all-proxies）时采用 X-Forwarded-For
+// 或 RFC 7239 Forwarded：从右向左遍历，跳过受信任代理追加的地址，返回第一个不受信任的地址；
+// 客户端在最左侧伪造的地址因此不会被采用。
+func getRealIP(c *gin.Context) string {
+	if isTrustedPeer(c.Request.RemoteAddr) {
+		// 代理可能另起一行追加头而不是拼接到已有的行上，多行按逗号合并后才能从最右侧的跳数开始遍历
+		xff := strings.Join(c.Request.Header.Values("X-Forwarded-For"), ",")
+		fwd := strings.Join(c.Request.Header.Values("Forwarded"), ",")
+		var ip netip.Addr
+		if forwardedHeader == forwardedHeaderForwarded || (forwardedHeader == forwardedHeaderAuto && xff == "" && fwd != "") {
+			ip = forwardedClient(fwd, parseForwardedFor)
+		} else {
+			ip = forwardedClient(xff, parseXFFHop)
+		}
+		if ip.IsValid() {
+			return ip.String()
+		}
+	}
+	return remoteHost(c.Request.RemoteAddr)
+}
+
+// clientSubnetHeader 非空时（-client-subnet-header），受信任代理在该头中传来的客户端子网
+// （类似 DNS 的 EDNS Client Subnet）优先作为未指定 ?ip 时的查询目标
+var clientSubnetHeader string
+
+// lookupTargetIP 返回未指定 ?ip 时要查询的地址：受信任代理传来的合法 CIDR 取其网络地址，
+// 否则为 getRealIP 得到的客户端 IP；拒绝名单、日志等仍以客户端 IP 为准
+func lookupTargetIP(c *gin.Context) string {
+	if clientSubnetHeader != "" && isTrustedPeer(c.Request.RemoteAddr) {
+		if p, ok := parseClientSubnet(c.GetHeader(clientSubnetHeader)); ok {
+			return p.Addr().String()
+		}
+	}
+	return getRealIP(c)
+}
+
+// errZonedIP 表示地址带有 zone（如 fe80::1%eth0）。zone 只在本机有意义，无法用于定位，
+// 而且会让同一地址产生不同的缓存 key
+var errZonedIP = errors.New("IP has a zone")
+
+// parseLookupIP 解析调用方指定的查询地址，拒绝带 zone 的地址
+func parseLookupIP(s string) (netip.Addr, error) {
+	ip, err := netip.ParseAddr(strings.TrimSpace(s))
+	if err == nil && ip.Zone() != "" {
+		return netip.Addr{}, errZonedIP
+	}
+	return ip, err
+}
+
+// requestedIP 返回本次请求要查询的地址：优先取 ?ip=，否则为 lookupTargetIP。
+// ?ip= 的值去掉首尾空白后为空（如 ?ip= 或 ?ip=%20）时与不带该参数相同，查询调用方自身。
+// 客户端经链路本地地址直连时 RemoteAddr 会带 zone，此时去掉 zone 而不是拒绝
+func requestedIP(c *gin.Context) (netip.Addr, error) {
+	if q := strings.TrimSpace(c.Query("ip")); q != "" {
+		return parseLookupIP(q)
+	}
+	ip, err := netip.ParseAddr(lookupTargetIP(c))
+	return ip.WithZone(""), err
+}
+
+// abortInvalidIP 以 400 INVALID_IP 结束请求，带 zone 的地址给出单独的说明
+func abortInvalidIP(c *gin.Context, err error) {
+	msg := "Invalid IP"
+	if errors.Is(err, errZonedIP) {
+		msg = "Invalid IP: addresses with a zone such as fe80::1%eth0 are not supported"
+	}
+	abortWithError(c, http.StatusBadRequest, ErrCodeInvalidIP, msg)
+}
+
+// parseClientSubnet 解析 CIDR 形式的客户端子网并清零主机位，如 203.0.113.77/24 → 203.0.113.0/24
+func parseClientSubnet(v string) (netip.Prefix, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return netip.Prefix{}, false
+	}
+	p, err := netip.ParsePrefix(v)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	return p.Masked(), true
+}
+
+// remoteHost 去掉 RemoteAddr 中的端口；部分监听器（如 Unix socket 或自定义 Listener）
+// 给出的地址不带端口，此时直接使用原值
+func remoteHost(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return strings.TrimSuffix(strings.TrimPrefix(remoteAddr, "["), "]")
+	}
+	return host
+}
+
+// forwardedClient 从右向左遍历逗号分隔的转发链，parse 解析单个元素中的地址
+func forwardedClient(list string, parse func(string) (netip.Addr, bool)) netip.Addr {
+	if list == "" || len(list) > maxXFFLength || strings.Count(list, ",") >= maxXFFHops {
+		return netip.Addr{}
+	}
+	var leftmost netip.Addr
+	for rest := list; ; {
+		hop := rest
+		i := strings.LastIndexByte(rest, ',')
+		if i >= 0 {
+			hop, rest = rest[i+1:], rest[:i]
+		}
+		ip, ok := parse(hop)
+		if !ok {
+			// 无法解析的地址之后（更左侧）的内容都不可信
+			break
+		}
+		ip = ip.Unmap()
+		if !isTrustedProxy(ip) {
+			return ip
+		}
+		leftmost = ip
+		if i < 0 {
+			break
+		}
+	}
+	// 全部是受信任代理时，取最左侧的地址
+	return leftmost
+}
+
+func parseXFFHop(hop string) (netip.Addr, bool) {
+	ip, err := netip.ParseAddr(strings.TrimSpace(hop))
+	return ip, err == nil
+}
+
+// parseForwardedFor 解析 Forwarded 单个元素（如 for="[2001:db8::1]:4711";proto=https）中的 for= 地址，
+// 支持带引号、带方括号的 IPv6 与端口；unknown 与 _hidden 这类混淆标识视为无法解析
+func parseForwardedFor(elem string) (netip.Addr, bool) {
+	for rest := elem; rest != ""; {
+		var pair string
+		pair, rest, _ = strings.Cut(rest, ";")
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || !strings.EqualFold(strings.TrimSpace(key), "for") {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = value[1 : len(value)-1]
+		}
+		host := value
+		if strings.HasPrefix(value, "[") {
+			end := strings.IndexByte(value, ']')
+			if end < 0 {
+				return netip.Addr{}, false
+			}
+			host = value[1:end]
+		} else if strings.Count(value, ":") == 1 {
+			host, _, _ = strings.Cut(value, ":")
+		}
+		ip, err := netip.ParseAddr(host)
+		return ip, err == nil
+	}
+	return netip.Addr{}, false
+}
+
+// isTrustedPeer 判断直连的对端（RemoteAddr）是否为受信任代理
+func isTrustedPeer(remoteAddr string) bool {
+	if trustAllProxies {
+		return true
+	}
+	ip, err := netip.ParseAddr(remoteHost(remoteAddr))
+	return err == nil && isTrustedProxy(ip)
+}
+
+// firstForwardedValue 取逗号分隔的转发头中最左侧（最外层代理写入）的值
+func firstForwardedValue(v string) string {
+	v, _, _ = strings.Cut(v, ",")
+	return strings.TrimSpace(v)
+}
+
+// publicBaseURL 返回客户端看到的服务地址（scheme://host）。直连对端为受信任代理时
+// 采用 X-Forwarded-Proto / X-Forwarded-Host，否则以本次连接为准，防止伪造的请求头写进绝对链接
+func publicBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	host := c.Request.Host
+
+	if isTrustedPeer(c.Request.RemoteAddr) {
+		if proto := strings.ToLower(firstForwardedValue(c.GetHeader("X-Forwarded-Proto"))); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+		if h := firstForwardedValue(c.GetHeader("X-Forwarded-Host")); h != "" && !strings.ContainsAny(h, "/\\@?# \t") {
+			host = h
+		}
+	}
+	return scheme + "://" + host
+}
+
+// ipHandler 以纯文本返回调用方 IP（按 getRealIP 解析），不查库，供 curl 等命令行直接使用
+func ipHandler(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.String(http.StatusOK, getRealIP(c)+"\n")
+}
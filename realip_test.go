@@ -0,0 +1,259 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newRealIPContext(remoteAddr, xff string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("GET", "/", nil)
+	c.Request.RemoteAddr = remoteAddr
+	if xff != "" {
+		c.Request.Header.Set("X-Forwarded-For", xff)
+	}
+	return c
+}
+
+func TestGetRealIP(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+
+	testCases := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		want       string
+	}{
+		{"NoXFF", "10.0.0.1:12345", "", "10.0.0.1"},
+		{"SingleIP", "10.0.0.1:12345", "8.8.8.8", "8.8.8.8"},
+		{"SpoofedLeftmost", "10.0.0.1:12345", "1.1.1.1, 8.8.8.8", "8.8.8.8"},
+		{"SkipTrustedHops", "10.0.0.1:12345", "8.8.8.8, 10.0.0.2, 192.168.1.1", "8.8.8.8"},
+		{"AllTrusted", "10.0.0.1:12345", "10.0.0.3, 10.0.0.2", "10.0.0.3"},
+		{"MalformedHop", "10.0.0.1:12345", "8.8.8.8, garbage, 10.0.0.2", "10.0.0.2"},
+		{"MappedIPv4", "10.0.0.1:12345", "::ffff:8.8.8.8", "8.8.8.8"},
+		{"TooManyHops", "10.0.0.1:12345", strings.Repeat("10.0.0.1, ", maxXFFHops) + "8.8.8.8", "10.0.0.1"},
+		{"TooLong", "10.0.0.1:12345", "8.8.8.8" + strings.Repeat(" ", maxXFFLength), "10.0.0.1"},
+		// 直连对端不是受信任代理时忽略 X-Forwarded-For
+		{"UntrustedPeer", "203.0.113.1:12345", "8.8.8.8", "203.0.113.1"},
+		{"UntrustedPeerNoXFF", "203.0.113.1:12345", "", "203.0.113.1"},
+		// RemoteAddr 不带端口时直接作为客户端 IP
+		{"NoPort", "203.0.113.1", "", "203.0.113.1"},
+		{"NoPortIPv6", "2001:db8::1", "", "2001:db8::1"},
+		{"NoPortBracketedIPv6", "[2001:db8::1]", "", "2001:db8::1"},
+		{"NoPortTrustedPeer", "10.0.0.1", "8.8.8.8", "8.8.8.8"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newRealIPContext(tc.remoteAddr, tc.xff)
+			if got := getRealIP(c); got != tc.want {
+				t.Errorf("getRealIP() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGetRealIPTrustAllProxies(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	trustAllProxies = true
+	defer func() { trustAllProxies = false }()
+
+	c := newRealIPContext("203.0.113.1:12345", "1.1.1.1, 8.8.8.8")
+	if got := getRealIP(c); got != "8.8.8.8" {
+		t.Errorf("getRealIP() = %q, want 8.8.8.8", got)
+	}
+}
+
+// 代理另起一行追加的跳数同样参与从右向左的遍历，客户端自带的第一行无法决定结果
+func TestGetRealIPMultiLineHeaders(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+
+	c := newRealIPContext("10.0.0.1:12345", "1.1.1.1")
+	c.Request.Header.Add("X-Forwarded-For", "8.8.8.8, 10.0.0.2")
+	if got := getRealIP(c); got != "8.8.8.8" {
+		t.Errorf("multi-line X-Forwarded-For: getRealIP() = %q, want 8.8.8.8", got)
+	}
+
+	forwardedHeader = forwardedHeaderForwarded
+	defer func() { forwardedHeader = forwardedHeaderAuto }()
+	c = newRealIPContext("10.0.0.1:12345", "")
+	c.Request.Header.Add("Forwarded", "for=1.1.1.1")
+	c.Request.Header.Add("Forwarded", "for=8.8.8.8")
+	if got := getRealIP(c); got != "8.8.8.8" {
+		t.Errorf("multi-line Forwarded: getRealIP() = %q, want 8.8.8.8", got)
+	}
+}
+
+func TestGetRealIPForwarded(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+
+	testCases := []struct {
+		name      string
+		mode      string
+		forwarded string
+		xff       string
+		want      string
+	}{
+		{"IPv4", forwardedHeaderAuto, "for=8.8.8.8", "", "8.8.8.8"},
+		{"QuotedIPv6", forwardedHeaderAuto, `for="[2001:db8:cafe::17]"`, "", "2001:db8:cafe::17"},
+		{"QuotedIPv6WithPort", forwardedHeaderAuto, `for="[2001:db8:cafe::17]:4711";proto=https`, "", "2001:db8:cafe::17"},
+		{"QuotedIPv4WithPort", forwardedHeaderAuto, `for="192.0.2.43:47011"`, "", "192.0.2.43"},
+		{"CaseInsensitiveKey", forwardedHeaderAuto, "proto=http;For=8.8.8.8;by=10.0.0.1", "", "8.8.8.8"},
+		{"SpoofedLeftmost", forwardedHeaderAuto, `for=1.1.1.1, for=8.8.8.8, for="[fc00::1]"`, "", "8.8.8.8"},
+		{"Obfuscated", forwardedHeaderAuto, "for=8.8.8.8, for=_hidden", "", "10.0.0.1"},
+		{"UnterminatedBracket", forwardedHeaderAuto, `for="[2001:db8::1"`, "", "10.0.0.1"},
+		{"AutoPrefersXFF", forwardedHeaderAuto, "for=1.1.1.1", "8.8.8.8", "8.8.8.8"},
+		{"ForcedForwarded", forwardedHeaderForwarded, "for=1.1.1.1", "8.8.8.8", "1.1.1.1"},
+		{"ForcedXFF", forwardedHeaderXFF, "for=1.1.1.1", "", "10.0.0.1"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			forwardedHeader = tc.mode
+			defer func() { forwardedHeader = forwardedHeaderAuto }()
+			c := newRealIPContext("10.0.0.1:12345", tc.xff)
+			c.Request.Header.Set("Forwarded", tc.forwarded)
+			if got := getRealIP(c); got != tc.want {
+				t.Errorf("getRealIP() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	c := newRealIPContext("203.0.113.1:12345", "")
+	c.Request.Header.Set("Forwarded", "for=8.8.8.8")
+	if got := getRealIP(c); got != "203.0.113.1" {
+		t.Errorf("untrusted peer: getRealIP() = %q", got)
+	}
+}
+
+func TestPublicBaseURL(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+
+	testCases := []struct {
+		name       string
+		remoteAddr string
+		proto      string
+		host       string
+		want       string
+	}{
+		{"Direct", "203.0.113.1:12345", "", "", "http://geo.local:8399"},
+		{"TrustedProxy", "10.0.0.2:12345", "https", "geo.example.com", "https://geo.example.com"},
+		{"UntrustedPeerIgnored", "203.0.113.1:12345", "https", "evil.example.com", "http://geo.local:8399"},
+		{"MultipleValues", "10.0.0.2:12345", "https, http", "geo.example.com, internal:8399", "https://geo.example.com"},
+		{"InvalidProto", "10.0.0.2:12345", "javascript", "", "http://geo.local:8399"},
+		{"InvalidHost", "10.0.0.2:12345", "", "evil.com/path", "http://geo.local:8399"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newRealIPContext(tc.remoteAddr, "")
+			c.Request.Host = "geo.local:8399"
+			if tc.proto != "" {
+				c.Request.Header.Set("X-Forwarded-Proto", tc.proto)
+			}
+			if tc.host != "" {
+				c.Request.Header.Set("X-Forwarded-Host", tc.host)
+			}
+			if got := publicBaseURL(c); got != tc.want {
+				t.Errorf("publicBaseURL() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLookupTargetIP(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	clientSubnetHeader = "X-Client-Subnet"
+	defer func() { clientSubnetHeader = "" }()
+
+	testCases := []struct {
+		name       string
+		remoteAddr string
+		subnet     string
+		want       string
+	}{
+		{"TrustedIPv4", "10.0.0.1:12345", "203.0.113.77/24", "203.0.113.0"},
+		{"TrustedIPv6", "10.0.0.1:12345", "2001:db8:abcd:12::1/56", "2001:db8:abcd::"},
+		{"InvalidCIDR", "10.0.0.1:12345", "203.0.113.77", "10.0.0.1"},
+		{"Missing", "10.0.0.1:12345", "", "10.0.0.1"},
+		// 非受信任对端的子网头被忽略
+		{"UntrustedPeer", "198.51.100.1:12345", "203.0.113.0/24", "198.51.100.1"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newRealIPContext(tc.remoteAddr, "")
+			if tc.subnet != "" {
+				c.Request.Header.Set("X-Client-Subnet", tc.subnet)
+			}
+			if got := lookupTargetIP(c); got != tc.want {
+				t.Errorf("lookupTargetIP() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	clientSubnetHeader = ""
+	c := newRealIPContext("10.0.0.1:12345", "")
+	c.Request.Header.Set("X-Client-Subnet", "203.0.113.0/24")
+	if got := lookupTargetIP(c); got != "10.0.0.1" {
+		t.Errorf("disabled header: lookupTargetIP() = %q", got)
+	}
+}
+
+func TestRequestedIPZone(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(requestIDMiddleware())
+	r.GET("/api/ipinfo", geoHandler)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/ipinfo?ip=fe80::1%25eth0", nil))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "zone") {
+		t.Errorf("zoned ?ip: status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	// 经链路本地地址直连时去掉 zone 后查询
+	c := newRealIPContext("[fe80::1%eth0]:12345", "")
+	if ip, err := requestedIP(c); err != nil || ip.String() != "fe80::1" {
+		t.Errorf("requestedIP() = %v, %v, want fe80::1", ip, err)
+	}
+}
+
+func TestRequestedIPEmpty(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	// 空值与纯空白均视为未指定，查询调用方；有效地址两侧的空白被忽略
+	for query, want := range map[string]string{
+		"":               "198.51.100.7",
+		"?ip=":           "198.51.100.7",
+		"?ip=%20":        "198.51.100.7",
+		"?ip=%20%09":     "198.51.100.7",
+		"?ip=%208.8.8.8": "8.8.8.8",
+	} {
+		c := newRealIPContext("198.51.100.7:12345", "")
+		c.Request.URL.RawQuery = strings.TrimPrefix(query, "?")
+		if ip, err := requestedIP(c); err != nil || ip.String() != want {
+			t.Errorf("requestedIP(%q) = %v, %v, want %s", query, ip, err, want)
+		}
+	}
+	if _, err := parseLookupIP(" "); err == nil {
+		t.Error("parseLookupIP(\" \") should fail where ip is required")
+	}
+}
+
+func TestIPHandler(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.GET("/ip", ipHandler)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/ip", nil)
+	req.RemoteAddr = "10.0.0.1:12345"
+	req.Header.Set("X-Forwarded-For", "8.8.8.8")
+	r.ServeHTTP(w, req)
+	if w.Body.String() != "8.8.8.8\n" || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("GET /ip = %q (%s)", w.Body.String(), w.Header().Get("Content-Type"))
+	}
+}
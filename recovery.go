@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// panicLog 为 panic 时输出的一行 JSON，便于事后按 request_id 或 IP 检索
+type panicLog struct {
+	Level     string `json:"level"`
+	Msg       string `json:"msg"`
+	RequestID string `json:"request_id,omitempty"`
+	ClientIP  string `json:"client_ip"`
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Route     string `json:"route,omitempty"`
+	Panic     string `json:"panic"`
+	Stack     string `json:"stack"`
+}
+
+// recoveryMiddleware 代替 gin.Recovery：panic 时输出带请求上下文的结构化日志，
+// 并以统一的错误结构返回 500；响应已开始写出或连接已断开时只终止请求
+func recoveryMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			// 与 net/http 一致，http.ErrAbortHandler 用于主动中断响应，不视为错误
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			requestID, _ := c.Get("RequestID")
+			id, _ := requestID.(string)
+			entry := panicLog{
+				Level:     "error",
+				Msg:       "panic recovered",
+				RequestID: id,
+				ClientIP:  getRealIP(c),
+				Method:    c.Request.Method,
+				Path:      c.Request.URL.Path,
+				Route:     c.FullPath(),
+				Panic:     fmt.Sprint(err),
+				Stack:     string(debug.Stack()),
+			}
+			if b, jerr := json.Marshal(entry); jerr == nil {
+				log.Printf("ERROR: %s", b)
+			} else {
+				log.Printf("ERROR: panic recovered [%s] %s %s: %v", id, c.Request.Method, c.Request.URL.Path, err)
+			}
+
+			if brokenConnection(err) || c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			abortWithError(c, http.StatusInternalServerError, ErrCodeInternal, "Internal server error")
+		}()
+		c.Next()
+	}
+}
+
+// brokenConnection 判断 panic 是否由客户端断开连接引起，此时无法再写出响应
+func brokenConnection(err any) bool {
+	ne, ok := err.(*net.OpError)
+	if !ok {
+		return false
+	}
+	var se *os.SyscallError
+	if !errors.As(ne, &se) {
+		return false
+	}
+	msg := strings.ToLower(se.Error())
+	return strings.Contains(msg, "broken pipe") || strings.Contains(msg, "connection reset by peer")
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRecoveryMiddleware(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(recoveryMiddleware(), requestIDMiddleware())
+	r.GET("/boom/:id", func(c *gin.Context) { panic("boom") })
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/boom/1", nil)
+	req.Header.Set("X-Request-ID", "panic-1")
+	req.RemoteAddr = "198.51.100.7:1234"
+	r.ServeHTTP(w, req)
+
+	var res ErrorResponse
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if w.Code != http.StatusInternalServerError || res.Code != ErrCodeInternal || res.RequestID != "panic-1" {
+		t.Errorf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	line := buf.String()
+	i := strings.Index(line, "{")
+	if i < 0 {
+		t.Fatalf("no structured log entry: %q", line)
+	}
+	var entry panicLog
+	if err := json.Unmarshal([]byte(strings.TrimSpace(line[i:])), &entry); err != nil {
+		t.Fatalf("log entry is not JSON: %v", err)
+	}
+	if entry.RequestID != "panic-1" || entry.ClientIP != "198.51.100.7" || entry.Path != "/boom/1" || entry.Route != "/boom/:id" || entry.Panic != "boom" {
+		t.Errorf("log entry = %+v", entry)
+	}
+	if !strings.Contains(entry.Stack, "recovery_test.go") {
+		t.Errorf("stack does not include the panicking handler: %s", entry.Stack)
+	}
+}
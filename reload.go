@@ -0,0 +1,58 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+type reloadConfig struct {
+	overridesPath   string
+	hostingASNsPath string
+	anycastListPath string
+}
+
+// handleReload 收到 SIGHUP 时热加载可变数据，失败时保留旧数据继续服务
+func handleReload(cfg reloadConfig) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		reload(cfg)
+	}
+}
+
+func reload(cfg reloadConfig) {
+	reloadDatabases()
+	reloadArchives()
+
+	if cfg.overridesPath != "" {
+		n, err := reloadOverrides(cfg.overridesPath)
+		if err != nil {
+			log.Printf("Failed to reload overrides, keeping previous: %v", err)
+		} else {
+			log.Printf("Reloaded %d overrides from %s", n, cfg.overridesPath)
+		}
+	}
+
+	if cfg.hostingASNsPath != "" {
+		n, err := reloadHostingASNs(cfg.hostingASNsPath)
+		if err != nil {
+			log.Printf("Failed to reload hosting ASNs, keeping previous: %v", err)
+		} else {
+			log.Printf("Reloaded %d hosting ASNs from %s", n, cfg.hostingASNsPath)
+		}
+	}
+
+	if cfg.anycastListPath != "" {
+		n, err := reloadAnycastList(cfg.anycastListPath)
+		if err != nil {
+			log.Printf("Failed to reload anycast list, keeping previous: %v", err)
+		} else {
+			log.Printf("Reloaded %d anycast entries from %s", n, cfg.anycastListPath)
+		}
+	}
+
+	// 以上任何数据变化都会影响响应内容，序列化好的响应一律丢弃
+	respCache.purge()
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/oschwald/maxminddb-golang/v2"
+)
+
+// reloadMaxNodeDrop 为热加载时允许的搜索树节点数降幅（百分比，-reload-max-node-drop），
+// 超过时视为截断或不完整的下载，保留旧库；0 为不检查
+var reloadMaxNodeDrop = 50.0
+
+// checkReplacement 判断新库能否替换当前库：构建时间不能早于当前库，
+// 节点数降幅不能超过 maxDrop 百分比。返回的错误说明拒绝原因
+func checkReplacement(cur, next maxminddb.Metadata, maxDrop float64) error {
+	if next.BuildEpoch < cur.BuildEpoch {
+		return fmt.Errorf("new build %s is older than current %s",
+			next.BuildTime().UTC().Format("2006-01-02T15:04:05Z"), cur.BuildTime().UTC().Format("2006-01-02T15:04:05Z"))
+	}
+	if maxDrop > 0 && cur.NodeCount > 0 && next.NodeCount < cur.NodeCount {
+		drop := float64(cur.NodeCount-next.NodeCount) / float64(cur.NodeCount) * 100
+		if drop > maxDrop {
+			return fmt.Errorf("node count dropped %.1f%% (%d -> %d), more than %.1f%%", drop, cur.NodeCount, next.NodeCount, maxDrop)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/oschwald/maxminddb-golang/v2"
+)
+
+func TestCheckReplacement(t *testing.T) {
+	cur := maxminddb.Metadata{BuildEpoch: 1000, NodeCount: 1000}
+	for _, tc := range []struct {
+		name    string
+		next    maxminddb.Metadata
+		maxDrop float64
+		ok      bool
+	}{
+		{"Newer", maxminddb.Metadata{BuildEpoch: 2000, NodeCount: 1100}, 50, true},
+		{"SameBuild", maxminddb.Metadata{BuildEpoch: 1000, NodeCount: 1000}, 50, true},
+		{"Older", maxminddb.Metadata{BuildEpoch: 999, NodeCount: 1000}, 50, false},
+		{"SmallDrop", maxminddb.Metadata{BuildEpoch: 2000, NodeCount: 600}, 50, true},
+		{"Truncated", maxminddb.Metadata{BuildEpoch: 2000, NodeCount: 100}, 50, false},
+		{"CheckDisabled", maxminddb.Metadata{BuildEpoch: 2000, NodeCount: 100}, 0, true},
+	} {
+		err := checkReplacement(cur, tc.next, tc.maxDrop)
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: checkReplacement = %v, want ok=%v", tc.name, err, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// isRemoteDBPath 判断 -city-mmdb 等参数是否为需要在启动时下载的 URL
+func isRemoteDBPath(p string) bool {
+	return strings.HasPrefix(p, "http://") || strings.HasPrefix(p, "https://") || strings.HasPrefix(p, "s3://")
+}
+
+// redactURL 去掉用户信息与查询串（如预签名 URL 的签名参数）后用于日志
+func redactURL(u *url.URL) string {
+	r := *u
+	r.User, r.RawQuery, r.Fragment = nil, "", ""
+	return r.String()
+}
+
+// remoteDB 把远端数据库下载到 dir 中缓存。缓存文件名由 URL 决定，旁边的 .meta 记录 ETag 与 Last-Modified，
+// 重启时以条件请求确认远端未变化即可直接使用缓存，无需重新下载
+type remoteDB struct {
+	client *http.Client
+	cfg    downloadConfig
+	dir    string
+	now    func() time.Time
+}
+
+type remoteDBMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	SHA256       string `json:"sha256"`
+}
+
+// parseRemoteDB 拆出 URL 片段中的期望校验和（如 ...mmdb#sha256=<hex>），片段不会发送给服务器
+func parseRemoteDB(raw string) (*url.URL, string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, "", err
+	}
+	var checksum string
+	if u.Fragment != "" {
+		v, ok := strings.CutPrefix(u.Fragment, "sha256=")
+		if !ok {
+			return nil, "", fmt.Errorf("unsupported URL fragment %q, expected #sha256=<hex>", u.Fragment)
+		}
+		if b, err := hex.DecodeString(v); err != nil || len(b) != sha256.Size {
+			return nil, "", errors.New("#sha256= must be 64 hex characters")
+		}
+		checksum = strings.ToLower(v)
+		u.Fragment = ""
+	}
+	if u.Host == "" {
+		return nil, "", fmt.Errorf("URL %q has no host", raw)
+	}
+	if u.Scheme == "s3" && strings.Trim(u.Path, "/") == "" {
+		return nil, "", fmt.Errorf("URL %q has no object key", raw)
+	}
+	return u, checksum, nil
+}
+
+// fetch 返回 raw 对应的本地文件路径：远端未变化时直接使用缓存，否则下载到临时文件、校验后替换缓存。
+// 下载失败但已有校验通过的缓存时沿用缓存并输出警告
+func (d *remoteDB) fetch(ctx context.Context, raw string) (string, error) {
+	u, checksum, err := parseRemoteDB(raw)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(d.dir, 0o755); err != nil {
+		return "", err
+	}
+	key := sha256.Sum256([]byte(u.String()))
+	name := path.Base(u.Path)
+	if name == "." || name == "/" {
+		name = "db.mmdb"
+	}
+	local := filepath.Join(d.dir, hex.EncodeToString(key[:8])+"-"+name)
+	meta, cached := d.loadMeta(local, u.String(), checksum)
+
+	updated, err := d.download(ctx, u, local, checksum, meta, cached)
+	switch {
+	case err != nil && cached:
+		log.Printf("WARNING: failed to download %s, using cached %s: %v", redactURL(u), local, err)
+	case err != nil:
+		return "", err
+	case updated:
+		log.Printf("Downloaded %s to %s", redactURL(u), local)
+	default:
+		log.Printf("Using cached %s for %s (unchanged)", local, redactURL(u))
+	}
+	return local, nil
+}
+
+// loadMeta 读取缓存文件的 .meta，文件缺失、URL 不符或内容与记录（及期望校验和）不一致时视为没有缓存
+func (d *remoteDB) loadMeta(local, rawURL, checksum string) (remoteDBMeta, bool) {
+	var meta remoteDBMeta
+	b, err := os.ReadFile(local + ".meta")
+	if err != nil || json.Unmarshal(b, &meta) != nil || meta.URL != rawURL {
+		return remoteDBMeta{}, false
+	}
+	if checksum != "" && meta.SHA256 != checksum {
+		return remoteDBMeta{}, false
+	}
+	sum, err := fileSHA256(local)
+	if err != nil || sum != meta.SHA256 {
+		return remoteDBMeta{}, false
+	}
+	return meta, true
+}
+
+// download 以条件请求拉取 u，返回是否写入了新文件
+func (d *remoteDB) download(ctx context.Context, u *url.URL, local, checksum string, meta remoteDBMeta, cached bool) (bool, error) {
+	resp, err := fetchRequestWithRetry(ctx, d.client, d.cfg, func(ctx context.Context) (*http.Request, error) {
+		req, err := d.newRequest(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+		if cached {
+			if meta.ETag != "" {
+				req.Header.Set("If-None-Match", meta.ETag)
+			}
+			if meta.LastModified != "" {
+				req.Header.Set("If-Modified-Since", meta.LastModified)
+			}
+		}
+		return req, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		if !cached {
+			return false, fmt.Errorf("GET %s: unexpected %s", redactURL(u), resp.Status)
+		}
+		return false, nil
+	}
+
+	tmp, err := os.CreateTemp(d.dir, ".download-*")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, h), resp.Body)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return false, fmt.Errorf("GET %s: %w", redactURL(u), err)
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	if checksum != "" && sum != checksum {
+		return false, fmt.Errorf("checksum mismatch for %s: got sha256 %s, want %s", redactURL(u), sum, checksum)
+	}
+	if err := os.Rename(tmp.Name(), local); err != nil {
+		return false, err
+	}
+
+	meta = remoteDBMeta{URL: u.String(), ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified"), SHA256: sum}
+	b, _ := json.Marshal(meta)
+	if err := os.WriteFile(local+".meta", b, 0o644); err != nil {
+		log.Printf("WARNING: failed to write %s.meta, the next start will download again: %v", local, err)
+	}
+	return true, nil
+}
+
+func (d *remoteDB) newRequest(ctx context.Context, u *url.URL) (*http.Request, error) {
+	if u.Scheme != "s3" {
+		return http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	}
+	target := s3ObjectURL(u.Host, strings.TrimPrefix(u.Path, "/"))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	// 环境变量中没有凭证时按公开读取的 bucket 处理，不签名
+	if os.Getenv("AWS_ACCESS_KEY_ID") != "" && os.Getenv("AWS_SECRET_ACCESS_KEY") != "" {
+		signS3Request(req, s3Region(), os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN"), d.now())
+	}
+	return req, nil
+}
+
+func s3Region() string {
+	for _, k := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if v := os.Getenv(k); v != "" {
+			return v
+		}
+	}
+	return "us-east-1"
+}
+
+// s3ObjectURL 返回对象的 HTTPS 地址：设置了 AWS_ENDPOINT_URL_S3 或 AWS_ENDPOINT_URL（如 MinIO）时使用 path-style，
+// 否则为 AWS 的 virtual-hosted-style
+func s3ObjectURL(bucket, key string) *url.URL {
+	escaped := s3EscapePath(key)
+	for _, k := range []string{"AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"} {
+		if v := os.Getenv(k); v != "" {
+			if base, err := url.Parse(strings.TrimSuffix(v, "/")); err == nil && base.Host != "" {
+				prefix := base.Path + "/" + bucket + "/"
+				base.Path, base.RawPath = prefix+key, s3EscapePath(prefix)+escaped
+				return base
+			}
+		}
+	}
+	return &url.URL{Scheme: "https", Host: bucket + ".s3." + s3Region() + ".amazonaws.com", Path: "/" + key, RawPath: "/" + escaped}
+}
+
+// s3EscapePath 按 SigV4 的规则编码对象 key：除非保留字符与 / 外全部百分号编码
+func s3EscapePath(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// signS3Request 以 AWS SigV4 签名 GET 请求，不对请求体签名（UNSIGNED-PAYLOAD）
+func signS3Request(req *http.Request, region, accessKey, secretKey, sessionToken string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	values := []string{req.URL.Host, "UNSIGNED-PAYLOAD", amzDate}
+	if sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+		signed = append(signed, "x-amz-security-token")
+		values = append(values, sessionToken)
+	}
+
+	var canonical strings.Builder
+	canonical.WriteString(req.Method + "\n" + req.URL.EscapedPath() + "\n" + req.URL.RawQuery + "\n")
+	for i, name := range signed {
+		canonical.WriteString(name + ":" + values[i] + "\n")
+	}
+	canonical.WriteString("\n" + strings.Join(signed, ";") + "\nUNSIGNED-PAYLOAD")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	hashed := sha256.Sum256([]byte(canonical.String()))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, strings.Join(signed, ";"), signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+func fileSHA256(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
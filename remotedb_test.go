@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRemoteDBFetch(t *testing.T) {
+	content := "mmdb-bytes"
+	var downloads, notModified atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(content))
+	}))
+	defer srv.Close()
+
+	cfg := downloadConfig{timeout: 5 * time.Second, backoff: time.Millisecond}
+	client, err := newDownloadClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &remoteDB{client: client, cfg: cfg, dir: t.TempDir(), now: time.Now}
+
+	sum := sha256.Sum256([]byte(content))
+	url := srv.URL + "/GeoLite2-City.mmdb#sha256=" + hex.EncodeToString(sum[:])
+	local, err := d.fetch(context.Background(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(local); string(b) != content || !strings.HasSuffix(local, "-GeoLite2-City.mmdb") {
+		t.Errorf("local = %s, content = %q", local, b)
+	}
+
+	// 重启后远端未变化，复用缓存
+	again, err := d.fetch(context.Background(), url)
+	if err != nil || again != local || downloads.Load() != 1 || notModified.Load() != 1 {
+		t.Errorf("second fetch: path = %s, err = %v, downloads = %d, 304s = %d", again, err, downloads.Load(), notModified.Load())
+	}
+
+	// 缓存文件被改动后不再信任，重新下载
+	os.WriteFile(local, []byte("corrupt"), 0o644)
+	if _, err := d.fetch(context.Background(), url); err != nil || downloads.Load() != 2 {
+		t.Errorf("corrupted cache: err = %v, downloads = %d", err, downloads.Load())
+	}
+
+	bad := srv.URL + "/other.mmdb#sha256=" + strings.Repeat("0", 64)
+	if _, err := d.fetch(context.Background(), bad); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("checksum mismatch err = %v", err)
+	}
+	if _, err := d.fetch(context.Background(), srv.URL+"/x.mmdb#md5=abc"); err == nil {
+		t.Error("expected error for unsupported fragment")
+	}
+}
+
+func TestS3ObjectURL(t *testing.T) {
+	t.Setenv("AWS_ENDPOINT_URL_S3", "")
+	t.Setenv("AWS_ENDPOINT_URL", "")
+	t.Setenv("AWS_REGION", "eu-west-1")
+	if got := s3ObjectURL("geo", "dbs/GeoLite2 City.mmdb").String(); got != "https://geo.s3.eu-west-1.amazonaws.com/dbs/GeoLite2%20City.mmdb" {
+		t.Errorf("virtual-hosted URL = %s", got)
+	}
+	t.Setenv("AWS_ENDPOINT_URL_S3", "http://minio:9000/")
+	if got := s3ObjectURL("geo", "GeoLite2-ASN.mmdb").String(); got != "http://minio:9000/geo/GeoLite2-ASN.mmdb" {
+		t.Errorf("path-style URL = %s", got)
+	}
+
+	req, _ := http.NewRequest("GET", "https://geo.s3.eu-west-1.amazonaws.com/GeoLite2-ASN.mmdb", nil)
+	signS3Request(req, "eu-west-1", "AKID", "secret", "", time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC))
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20250102/eu-west-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=") {
+		t.Errorf("Authorization = %q", auth)
+	}
+	if req.Header.Get("X-Amz-Date") != "20250102T030405Z" {
+		t.Errorf("X-Amz-Date = %q", req.Header.Get("X-Amz-Date"))
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// -request-id-format 的取值
+const (
+	requestIDUUID  = "uuid"  // 523a8da8-2e62-44ad-bd2e-e75411949309
+	requestIDHex32 = "hex32" // 32 位十六进制，与 W3C trace-id 格式一致
+	requestIDShort = "short" // 16 位十六进制
+)
+
+var (
+	// newRequestID 为未携带（或携带了非法）X-Request-ID 时的 ID 生成器
+	newRequestID = uuid.NewString
+	// traceparentRequestID 为 true 时，未携带 X-Request-ID 的请求复用 traceparent 中的 trace-id
+	traceparentRequestID bool
+)
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func setRequestIDFormat(format string) error {
+	switch format {
+	case requestIDUUID:
+		newRequestID = uuid.NewString
+	case requestIDHex32:
+		newRequestID = func() string { return randomHex(16) }
+	case requestIDShort:
+		newRequestID = func() string { return randomHex(8) }
+	default:
+		return fmt.Errorf("unknown request ID format %q: must be uuid, hex32 or short", format)
+	}
+	return nil
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if (s[i] < '0' || s[i] > '9') && (s[i] < 'a' || s[i] > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// traceIDFromTraceparent 从 W3C traceparent（version-traceid-parentid-flags）中取出 trace-id，
+// 格式不合法、版本为 ff 或 trace-id 全零时返回空串
+func traceIDFromTraceparent(h string) string {
+	parts := strings.Split(strings.TrimSpace(h), "-")
+	if len(parts) < 4 {
+		return ""
+	}
+	version, traceID, parentID, flags := parts[0], parts[1], parts[2], parts[3]
+	if len(version) != 2 || !isLowerHex(version) || version == "ff" || (version == "00" && len(parts) != 4) {
+		return ""
+	}
+	if len(traceID) != 32 || !isLowerHex(traceID) || traceID == strings.Repeat("0", 32) {
+		return ""
+	}
+	if len(parentID) != 16 || !isLowerHex(parentID) || len(flags) != 2 || !isLowerHex(flags) {
+		return ""
+	}
+	return traceID
+}
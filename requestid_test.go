@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSetRequestIDFormat(t *testing.T) {
+	defer setRequestIDFormat(requestIDUUID)
+
+	for format, pattern := range map[string]string{
+		requestIDUUID:  `^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`,
+		requestIDHex32: `^[0-9a-f]{32}$`,
+		requestIDShort: `^[0-9a-f]{16}$`,
+	} {
+		if err := setRequestIDFormat(format); err != nil {
+			t.Fatal(err)
+		}
+		if id := newRequestID(); !regexp.MustCompile(pattern).MatchString(id) {
+			t.Errorf("%s: generated %q", format, id)
+		}
+	}
+	if err := setRequestIDFormat("ulid"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestTraceIDFromTraceparent(t *testing.T) {
+	for h, want := range map[string]string{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01":     "4bf92f3577b34da6a3ce929d0e0e4736",
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-ext": "4bf92f3577b34da6a3ce929d0e0e4736",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-ext": "",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01":     "",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01":     "",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01":     "",
+		"00-4bf92f3577b34da6-00f067aa0ba902b7-01":                     "",
+		"garbage": "",
+	} {
+		if got := traceIDFromTraceparent(h); got != want {
+			t.Errorf("traceIDFromTraceparent(%q) = %q, want %q", h, got, want)
+		}
+	}
+}
+
+func TestRequestIDFromTraceparent(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	traceparentRequestID = true
+	defer func() { traceparentRequestID = false }()
+
+	r := gin.New()
+	r.Use(requestIDMiddleware())
+	r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("traceparent", traceparent)
+	r.ServeHTTP(w, req)
+	if got := w.Header().Get("X-Request-ID"); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("request ID = %q", got)
+	}
+
+	// 显式的 X-Request-ID 优先
+	w = httptest.NewRecorder()
+	req.Header.Set("X-Request-ID", "abc-123")
+	r.ServeHTTP(w, req)
+	if got := w.Header().Get("X-Request-ID"); got != "abc-123" {
+		t.Errorf("request ID = %q, want abc-123", got)
+	}
+}
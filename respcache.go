@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/groupcache/lru"
+)
+
+// respCache 为 /api/ipinfo 的响应缓存（-response-cache），nil 表示关闭。
+// 与记录缓存不同，这里保存序列化好的响应体，key 包含查询串，完全相同的请求命中后不再查库和序列化
+var respCache *responseCache
+
+var (
+	// respRequestIDSentinel、respTimestampSentinel 在写入缓存时代替 request_id 与 timestamp，
+	// 命中时替换为本次请求的值；二者都不会出现在正常响应中
+	respRequestIDSentinel = "\x00request_id\x00"
+	respTimestampSentinel = Timestamp(math.MinInt64)
+)
+
+type responseCache struct {
+	mu    sync.Mutex
+	lru   *lru.Cache
+	ttl   time.Duration
+	hits  atomic.Uint64
+	miss  atomic.Uint64
+	clock func() time.Time
+}
+
+type cachedResponse struct {
+	body        []byte
+	contentType string
+	etag        string
+	storedAt    time.Time
+}
+
+func newResponseCache(size int, ttl time.Duration) *responseCache {
+	return &responseCache{lru: lru.New(size), ttl: ttl, clock: time.Now}
+}
+
+// responseCacheKey 由解析出的 IP、原始查询串以及会影响响应的请求头组成；
+// 不带 ip 参数时按客户端 IP 区分，未指定 lang 时按 Accept-Language 区分
+func responseCacheKey(ip, rawQuery, acceptLanguage, colo string) string {
+	return strings.Join([]string{ip, rawQuery, acceptLanguage, colo}, "\x00")
+}
+
+func (rc *responseCache) get(key string) (*cachedResponse, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	v, ok := rc.lru.Get(key)
+	if ok && rc.ttl > 0 && rc.clock().Sub(v.(*cachedResponse).storedAt) >= rc.ttl {
+		rc.lru.Remove(key)
+		ok = false
+	}
+	if !ok {
+		rc.miss.Add(1)
+		return nil, false
+	}
+	rc.hits.Add(1)
+	return v.(*cachedResponse), true
+}
+
+func (rc *responseCache) add(key string, e *cachedResponse) {
+	e.storedAt = rc.clock()
+	rc.mu.Lock()
+	rc.lru.Add(key, e)
+	rc.mu.Unlock()
+}
+
+// purge 清空缓存，数据库、覆盖规则等热加载后调用
+func (rc *responseCache) purge() {
+	if rc == nil {
+		return
+	}
+	rc.mu.Lock()
+	rc.lru.Clear()
+	rc.mu.Unlock()
+}
+
+// stats 返回累计命中、未命中次数与命中率
+func (rc *responseCache) stats() (hits, misses uint64, ratio float64) {
+	hits, misses = rc.hits.Load(), rc.miss.Load()
+	if hits+misses > 0 {
+		ratio = float64(hits) / float64(hits+misses)
+	}
+	return hits, misses, ratio
+}
+
+// serializeResponse 按 gin 的 JSON/JSONP 渲染方式序列化 body，callback 已经过 validCallback 校验
+func serializeResponse(body any, callback string) ([]byte, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	if callback == "" {
+		return data, nil
+	}
+	out := make([]byte, 0, len(callback)+len(data)+3)
+	out = append(out, callback...)
+	out = append(out, '(')
+	out = append(out, data...)
+	return append(out, ");"...), nil
+}
+
+// render 把缓存的响应体中的占位值换成本次请求的 request_id 与 timestamp
+func (e *cachedResponse) render(requestID string, ts Timestamp) []byte {
+	body := e.body
+	if sentinel, err := json.Marshal(respRequestIDSentinel); err == nil {
+		id, _ := json.Marshal(requestID)
+		body = bytes.ReplaceAll(body, sentinel, id)
+	}
+	if sentinel, err := respTimestampSentinel.MarshalJSON(); err == nil {
+		now, _ := ts.MarshalJSON()
+		body = bytes.ReplaceAll(body, sentinel, now)
+	}
+	return body
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestResponseCache(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(requestIDMiddleware())
+	r.GET("/api/ipinfo", geoHandler)
+
+	respCache = newResponseCache(10, time.Minute)
+	defer func() { respCache = nil }()
+	now := time.Now()
+	respCache.clock = func() time.Time { return now }
+
+	get := func(query, requestID string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/ipinfo"+query, nil)
+		req.Header.Set("X-Request-ID", requestID)
+		r.ServeHTTP(w, req)
+		return w
+	}
+	decode := func(w *httptest.ResponseRecorder) GeoResponse {
+		var res GeoResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatalf("decode %q: %v", w.Body.String(), err)
+		}
+		return res
+	}
+
+	first := get("?ip=127.0.0.1", "req-1")
+	second := get("?ip=127.0.0.1", "req-2")
+	if hits, misses, _ := respCache.stats(); hits != 1 || misses != 1 {
+		t.Fatalf("hits = %d, misses = %d, want 1 and 1", hits, misses)
+	}
+	a, b := decode(first), decode(second)
+	if a.RequestID != "req-1" || b.RequestID != "req-2" || b.Timestamp <= 0 {
+		t.Errorf("request_id/timestamp not per request: %+v, %+v", a, b)
+	}
+	if a.IP != b.IP || a.IsLoopback != b.IsLoopback {
+		t.Errorf("cached body differs: %+v vs %+v", a, b)
+	}
+	if first.Header().Get("ETag") == "" || first.Header().Get("ETag") != second.Header().Get("ETag") {
+		t.Errorf("ETag = %q vs %q", first.Header().Get("ETag"), second.Header().Get("ETag"))
+	}
+
+	// 查询串不同即为不同的缓存项
+	w := get("?ip=127.0.0.1&fields=ip&callback=cb", "req-3")
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/javascript") {
+		t.Errorf("JSONP Content-Type = %q", ct)
+	}
+	if body := w.Body.String(); body != `cb({"ip":"127.0.0.1"});` {
+		t.Errorf("JSONP body = %q", body)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/ipinfo?ip=127.0.0.1", nil)
+	req.Header.Set("If-None-Match", first.Header().Get("ETag"))
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match on cached response: status = %d", w.Code)
+	}
+
+	respCache.purge()
+	get("?ip=127.0.0.1", "req-4")
+	now = now.Add(time.Minute)
+	get("?ip=127.0.0.1", "req-5")
+	if hits, misses, _ := respCache.stats(); hits != 2 || misses != 4 {
+		t.Errorf("after purge and expiry: hits = %d, misses = %d, want 2 and 4", hits, misses)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"net/http"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// selftestIPs 为自检使用的固定地址，覆盖常见公共 DNS 的 IPv4 与 IPv6
+var selftestIPs = []netip.Addr{
+	netip.MustParseAddr("8.8.8.8"),
+	netip.MustParseAddr("1.1.1.1"),
+	netip.MustParseAddr("9.9.9.9"),
+	netip.MustParseAddr("208.67.222.222"),
+	netip.MustParseAddr("114.114.114.114"),
+	netip.MustParseAddr("223.5.5.5"),
+	netip.MustParseAddr("2001:4860:4860::8888"),
+	netip.MustParseAddr("2606:4700:4700::1111"),
+}
+
+const maxSelftestRounds = 1000
+
+type SelftestResponse struct {
+	IPs    int `json:"ips"`
+	Rounds int `json:"rounds"`
+	// ColdAvgUs 为绕过缓存直接查询各主库的单次平均耗时（微秒）
+	ColdAvgUs float64 `json:"cold_avg_us"`
+	// WarmAvgUs 为命中缓存的单次平均耗时，-cache 0 时不返回
+	WarmAvgUs *float64 `json:"warm_avg_us,omitempty"`
+	Speedup   float64  `json:"speedup,omitempty"`
+	// Databases 为各主库单次查询的平均耗时（微秒），未加载的库不出现
+	Databases map[string]float64 `json:"databases_avg_us"`
+}
+
+func avgMicros(d time.Duration, n int) float64 {
+	return float64(d) / float64(time.Microsecond) / float64(n)
+}
+
+// selftestHandler 对固定地址分别测量冷查询与缓存命中的耗时，便于评估缓存在本机与当前库上的收益。
+// 冷查询直接调用各库的 Reader，不经过回退库，也不计入健康检查与 geoip_db_answers_total；
+// 热查询前会把这些地址写入缓存
+func selftestHandler(c *gin.Context) {
+	rounds, err := strconv.Atoi(c.DefaultQuery("rounds", "100"))
+	if err != nil || rounds < 1 || rounds > maxSelftestRounds {
+		abortWithError(c, http.StatusBadRequest, ErrCodeInvalidParam, "rounds must be an integer between 1 and 1000")
+		return
+	}
+	if cacheOnly() {
+		abortWithError(c, http.StatusServiceUnavailable, ErrCodeDBUnavailable, "Database unavailable")
+		return
+	}
+
+	var cityTime, asnTime, ispTime time.Duration
+	loaded := map[string]bool{}
+	for range rounds {
+		for _, ip := range selftestIPs {
+			dbMutex.RLock()
+			if countryDB != nil {
+				loaded["city"] = true
+				start := time.Now()
+				if countryDBEnterprise {
+					_, _ = countryDB.Enterprise(ip)
+				} else {
+					_, _ = countryDB.City(ip)
+				}
+				cityTime += time.Since(start)
+			}
+			if asnDB != nil {
+				loaded["asn"] = true
+				start := time.Now()
+				_, _ = asnDB.ASN(ip)
+				asnTime += time.Since(start)
+			}
+			if ispDB != nil {
+				loaded["isp"] = true
+				start := time.Now()
+				if ispDBEnterprise {
+					_, _ = ispDB.Enterprise(ip)
+				} else {
+					_, _ = ispDB.ISP(ip)
+				}
+				ispTime += time.Since(start)
+			}
+			dbMutex.RUnlock()
+		}
+	}
+
+	n := rounds * len(selftestIPs)
+	res := SelftestResponse{
+		IPs:       len(selftestIPs),
+		Rounds:    rounds,
+		ColdAvgUs: avgMicros(cityTime+asnTime+ispTime, n),
+		Databases: map[string]float64{},
+	}
+	for name, d := range map[string]time.Duration{"city": cityTime, "asn": asnTime, "isp": ispTime} {
+		if loaded[name] {
+			res.Databases[name] = avgMicros(d, n)
+		}
+	}
+
+	if geoCache != nil {
+		for _, ip := range selftestIPs {
+			if _, ok := cacheGet(ip); !ok {
+				if _, err := lookupAndCache(ip, lookupOptions{}); err != nil {
+					abortWithError(c, http.StatusInternalServerError, ErrCodeLookupFailed, "Failed to warm cache")
+					return
+				}
+			}
+		}
+		var warmTime time.Duration
+		for range rounds {
+			for _, ip := range selftestIPs {
+				start := time.Now()
+				cacheGet(ip)
+				warmTime += time.Since(start)
+			}
+		}
+		warm := avgMicros(warmTime, n)
+		res.WarmAvgUs = &warm
+		if warm > 0 {
+			res.Speedup = res.ColdAvgUs / warm
+		}
+	}
+	c.JSON(http.StatusOK, res)
+}
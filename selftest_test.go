@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSelftestHandler(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	orig := geoCache
+	geoCache = newGeoCache(100)
+	defer func() { geoCache = orig }()
+
+	r := gin.New()
+	r.GET("/api/selftest", selftestHandler)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/selftest?rounds=2", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var res SelftestResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.IPs != len(selftestIPs) || res.Rounds != 2 {
+		t.Errorf("ips = %d, rounds = %d", res.IPs, res.Rounds)
+	}
+	if res.WarmAvgUs == nil {
+		t.Error("warm timing missing with cache enabled")
+	}
+	if geoCache.Len() != len(selftestIPs) {
+		t.Errorf("cache has %d entries, want %d", geoCache.Len(), len(selftestIPs))
+	}
+
+	for _, rounds := range []string{"0", "1001", "x"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/selftest?rounds="+rounds, nil)
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("rounds=%s: status = %d, want 400", rounds, w.Code)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// listFlag 支持重复指定或逗号分隔的多值参数，如 -port :8399 -port 127.0.0.1:8400
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+type serverConfig struct {
+	addrs    []string
+	tlsAddrs []string
+	certFile string
+	keyFile  string
+	h2c      bool // 明文监听同时接受 HTTP/2 cleartext
+	// 对应 -read-timeout 等参数，0 表示不限制
+	readTimeout       time.Duration
+	readHeaderTimeout time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+	// listeners / tlsListeners 为已经监听好的 socket（systemd socket activation），非空时分别代替 addrs / tlsAddrs
+	listeners    []net.Listener
+	tlsListeners []net.Listener
+	// portFile 非空时，在全部地址监听成功后写入实际监听地址（每行一个），退出时删除
+	portFile string
+}
+
+const shutdownTimeout = 10 * time.Second
+
+// withH2C 让明文监听同时支持 HTTP/2 升级与 prior knowledge 连接；
+// TLS 监听由 http.Server 通过 ALPN 自动协商 HTTP/2，无需包装
+func withH2C(handler http.Handler) http.Handler {
+	return h2c.NewHandler(handler, &http2.Server{})
+}
+
+// serve 为每个监听地址启动一个 http.Server，共享同一个 handler。
+// 所有地址先同步完成监听，:0 等由系统分配的端口会在日志与 portFile 中给出实际地址；
+// ctx 结束或任一 server 异常退出时，优雅关闭所有 server。
+func serve(ctx context.Context, handler http.Handler, cfg serverConfig) error {
+	type listener struct {
+		ln     net.Listener
+		useTLS bool
+	}
+	var listeners []listener
+	closeAll := func() {
+		for _, l := range listeners {
+			l.ln.Close()
+		}
+	}
+	for _, ln := range cfg.listeners {
+		listeners = append(listeners, listener{ln, false})
+	}
+	for _, ln := range cfg.tlsListeners {
+		listeners = append(listeners, listener{ln, true})
+	}
+	if len(cfg.listeners) == 0 {
+		for _, addr := range cfg.addrs {
+			ln, err := net.Listen("tcp", addr)
+			if err != nil {
+				closeAll()
+				return err
+			}
+			listeners = append(listeners, listener{ln, false})
+		}
+	}
+	if len(cfg.tlsListeners) == 0 {
+		for _, addr := range cfg.tlsAddrs {
+			ln, err := net.Listen("tcp", addr)
+			if err != nil {
+				closeAll()
+				return err
+			}
+			listeners = append(listeners, listener{ln, true})
+		}
+	}
+
+	if cfg.portFile != "" {
+		addrs := make([]string, len(listeners))
+		for i, l := range listeners {
+			addrs[i] = l.ln.Addr().String()
+		}
+		if err := writePortFile(cfg.portFile, addrs); err != nil {
+			closeAll()
+			return err
+		}
+		defer os.Remove(cfg.portFile)
+	}
+
+	var servers []*http.Server
+	errCh := make(chan error, len(listeners))
+
+	plainHandler := handler
+	if cfg.h2c {
+		plainHandler = withH2C(handler)
+	}
+
+	for _, l := range listeners {
+		srv := &http.Server{
+			Addr:              l.ln.Addr().String(),
+			Handler:           handler,
+			ReadTimeout:       cfg.readTimeout,
+			ReadHeaderTimeout: cfg.readHeaderTimeout,
+			WriteTimeout:      cfg.writeTimeout,
+			IdleTimeout:       cfg.idleTimeout,
+		}
+		if !l.useTLS {
+			srv.Handler = plainHandler
+		}
+		servers = append(servers, srv)
+		go func() {
+			var err error
+			if l.useTLS {
+				log.Printf("Listening and serving HTTPS on %s", srv.Addr)
+				err = srv.ServeTLS(l.ln, cfg.certFile, cfg.keyFile)
+			} else {
+				log.Printf("Listening and serving HTTP on %s", srv.Addr)
+				err = srv.Serve(l.ln)
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errCh <- err
+				return
+			}
+			errCh <- nil
+		}()
+	}
+
+	var serveErr error
+	select {
+	case <-ctx.Done():
+	case serveErr = <-errCh:
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, srv := range servers {
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Failed to shutdown server on %s: %v", srv.Addr, err)
+		}
+	}
+	return serveErr
+}
+
+// writePortFile 先写临时文件再重命名，轮询该文件的脚本不会读到写了一半的内容
+func writePortFile(path string, addrs []string) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strings.Join(addrs, "\n")+"\n"), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// clearWriteDeadline 取消当前连接的写超时，供导出、遍历、批量查询等长时间流式输出的接口使用；
+// 这些接口在逐批写出时检查客户端是否断开，不依赖 -write-timeout
+func clearWriteDeadline(c *gin.Context) {
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("Failed to clear write deadline: %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/http2"
+)
+
+func TestH2CConcurrentStreams(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.GET("/proto", func(c *gin.Context) {
+		c.String(http.StatusOK, c.Request.Proto)
+	})
+
+	srv := httptest.NewServer(withH2C(r))
+	defer srv.Close()
+
+	var dials int
+	var dialMu sync.Mutex
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			dialMu.Lock()
+			dials++
+			dialMu.Unlock()
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+
+	const streams = 32
+	var wg sync.WaitGroup
+	errs := make(chan error, streams)
+	for range streams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Get(srv.URL + "/proto")
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.ProtoMajor != 2 || string(body) != "HTTP/2.0" {
+				t.Errorf("expected HTTP/2 response, got %s (handler saw %q)", resp.Proto, body)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	if dials != 1 {
+		t.Errorf("expected streams to share one connection, got %d dials", dials)
+	}
+}
+
+func TestServeRandomPortFile(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+
+	portFile := filepath.Join(t.TempDir(), "port")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- serve(ctx, r, serverConfig{addrs: []string{"127.0.0.1:0"}, portFile: portFile}) }()
+
+	var addr string
+	for range 100 {
+		if data, err := os.ReadFile(portFile); err == nil {
+			addr = strings.TrimSpace(string(data))
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if addr == "" || strings.HasSuffix(addr, ":0") {
+		t.Fatalf("port file address = %q", addr)
+	}
+
+	resp, err := http.Get("http://" + addr + "/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "pong" {
+		t.Errorf("body = %q", body)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("serve() = %v", err)
+	}
+	if _, err := os.Stat(portFile); !os.IsNotExist(err) {
+		t.Error("port file should be removed on shutdown")
+	}
+}
+
+func TestServeTimeouts(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.GET("/stream", func(c *gin.Context) {
+		clearWriteDeadline(c)
+		time.Sleep(150 * time.Millisecond)
+		c.String(http.StatusOK, "done")
+	})
+
+	portFile := filepath.Join(t.TempDir(), "port")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go serve(ctx, r, serverConfig{
+		addrs:             []string{"127.0.0.1:0"},
+		portFile:          portFile,
+		readHeaderTimeout: 100 * time.Millisecond,
+		writeTimeout:      50 * time.Millisecond,
+	})
+
+	var addr string
+	for range 100 {
+		if data, err := os.ReadFile(portFile); err == nil {
+			addr = strings.TrimSpace(string(data))
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if addr == "" {
+		t.Fatal("server did not start")
+	}
+
+	// 请求头迟迟不发完的连接会被关闭
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "GET /stream HTTP/1.1\r\nHost: x\r\n")
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.ReadAll(conn); err != nil {
+		t.Errorf("slow header connection was not closed by the server: %v", err)
+	}
+
+	// 取消写超时的接口可以超过 -write-timeout
+	resp, err := http.Get("http://" + addr + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "done" {
+		t.Errorf("body = %q", body)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+)
+
+// sloMinRequests 为窗口内触发告警所需的最少请求数，避免个别慢请求在低流量时误报
+const sloMinRequests = 20
+
+// sloAlert 为 -slo-webhook 收到的 JSON
+type sloAlert struct {
+	Path          string    `json:"path"`
+	LatencyP99Ms  float64   `json:"latency_p99_ms"`
+	ThresholdMs   float64   `json:"threshold_ms"`
+	Requests      uint64    `json:"requests"`
+	WindowSeconds float64   `json:"window_seconds"`
+	Host          string    `json:"host,omitempty"`
+	Time          time.Time `json:"time"`
+}
+
+// sloMonitor 每个窗口比较各路由的 p99 与阈值，超出时向 webhook 发送告警，
+// 同一路由在 cooldown 内只告警一次
+type sloMonitor struct {
+	webhook   string
+	threshold time.Duration
+	window    time.Duration
+	cooldown  time.Duration
+	client    *http.Client
+	host      string
+
+	prev      map[string]latencyCounts
+	lastAlert map[string]time.Time
+}
+
+func newSLOMonitor(webhook string, threshold, window, cooldown time.Duration) *sloMonitor {
+	host, _ := os.Hostname()
+	return &sloMonitor{
+		webhook:   webhook,
+		threshold: threshold,
+		window:    window,
+		cooldown:  cooldown,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		host:      host,
+		prev:      make(map[string]latencyCounts),
+		lastAlert: make(map[string]time.Time),
+	}
+}
+
+// check 计算上次调用以来各路由的 p99，返回需要发送的告警
+func (m *sloMonitor) check(now time.Time) []sloAlert {
+	var alerts []sloAlert
+	routeLatency.Range(func(k, v any) bool {
+		path := k.(string)
+		cur := v.(*latencyHistogram).snapshot()
+		delta := cur.sub(m.prev[path])
+		m.prev[path] = cur
+
+		n := delta.total()
+		if n < sloMinRequests {
+			return true
+		}
+		p99 := delta.percentiles(0.99)[0]
+		if p99 <= m.threshold || now.Sub(m.lastAlert[path]) < m.cooldown {
+			return true
+		}
+		m.lastAlert[path] = now
+		alerts = append(alerts, sloAlert{
+			Path:          path,
+			LatencyP99Ms:  toMillis(p99),
+			ThresholdMs:   toMillis(m.threshold),
+			Requests:      n,
+			WindowSeconds: m.window.Seconds(),
+			Host:          m.host,
+			Time:          now.UTC(),
+		})
+		return true
+	})
+	slices.SortFunc(alerts, func(a, b sloAlert) int { return cmp.Compare(a.Path, b.Path) })
+	return alerts
+}
+
+func (m *sloMonitor) post(ctx context.Context, alert sloAlert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "geoip-server/"+Version)
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (m *sloMonitor) run(ctx context.Context) {
+	ticker := time.NewTicker(m.window)
+	defer ticker.Stop()
+	m.check(time.Now()) // 以启动时的计数为基线
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, alert := range m.check(now) {
+				log.Printf("WARNING: %s p99 %.1fms exceeds SLO %.1fms over %d requests", alert.Path, alert.LatencyP99Ms, alert.ThresholdMs, alert.Requests)
+				if err := m.post(ctx, alert); err != nil {
+					log.Printf("Failed to send SLO alert: %v", err)
+				}
+			}
+		}
+	}
+}
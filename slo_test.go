@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSLOMonitor(t *testing.T) {
+	const path = "/test/slo"
+	h := routeHistogram(path)
+	m := newSLOMonitor("", 100*time.Millisecond, time.Minute, 10*time.Minute)
+	alertsFor := func(now time.Time) []sloAlert {
+		var got []sloAlert
+		for _, a := range m.check(now) {
+			if a.Path == path {
+				got = append(got, a)
+			}
+		}
+		return got
+	}
+	now := time.Now()
+	alertsFor(now)
+
+	for range 30 {
+		h.observe(time.Second)
+	}
+	alerts := alertsFor(now.Add(time.Minute))
+	if len(alerts) != 1 || alerts[0].Requests != 30 || alerts[0].LatencyP99Ms != 1000 {
+		t.Fatalf("alerts = %+v, want one for 30 slow requests", alerts)
+	}
+
+	// 冷却期内不重复告警
+	for range 30 {
+		h.observe(time.Second)
+	}
+	if alerts := alertsFor(now.Add(2 * time.Minute)); len(alerts) != 0 {
+		t.Errorf("alerted again within cooldown: %+v", alerts)
+	}
+
+	// 只统计窗口内的请求，之前的慢请求不影响
+	for range 30 {
+		h.observe(time.Millisecond)
+	}
+	if alerts := alertsFor(now.Add(30 * time.Minute)); len(alerts) != 0 {
+		t.Errorf("fast window alerted: %+v", alerts)
+	}
+}
+
+func TestSLOMonitorPost(t *testing.T) {
+	var got sloAlert
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	m := newSLOMonitor(srv.URL, time.Millisecond, time.Minute, time.Minute)
+	if err := m.post(context.Background(), sloAlert{Path: "/api/ipinfo", LatencyP99Ms: 250}); err != nil {
+		t.Fatal(err)
+	}
+	if got.Path != "/api/ipinfo" || got.LatencyP99Ms != 250 {
+		t.Errorf("webhook received %+v", got)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// slowTracker 保留最近 window 内最慢的 capacity 个请求，数组大小固定，
+// 新请求只有比其中最快的一条更慢（或有记录已过期）时才替换进来
+type slowTracker struct {
+	mu       sync.Mutex
+	capacity int
+	window   time.Duration
+	entries  []SlowRequest
+}
+
+type SlowRequest struct {
+	Time      time.Time `json:"time"`
+	LatencyMs float64   `json:"latency_ms"`
+	RequestID string    `json:"request_id,omitempty"`
+	ClientIP  string    `json:"client_ip"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Route     string    `json:"route,omitempty"`
+	Status    int       `json:"status"`
+
+	latency time.Duration
+}
+
+func newSlowTracker(capacity int, window time.Duration) *slowTracker {
+	return &slowTracker{capacity: capacity, window: window, entries: make([]SlowRequest, 0, capacity)}
+}
+
+var slowRequests = newSlowTracker(50, time.Hour)
+
+// observe 记录一个请求，只有被保留时才调用 build 生成详情，避免每个请求都提取客户端 IP 等信息
+func (t *slowTracker) observe(at time.Time, latency time.Duration, build func() SlowRequest) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	victim := len(t.entries)
+	if victim == t.capacity {
+		// 优先替换已过期的记录，其次替换最快的一条
+		victim = 0
+		for i, e := range t.entries {
+			if t.window > 0 && at.Sub(e.Time) > t.window {
+				victim = i
+				break
+			}
+			if e.latency < t.entries[victim].latency {
+				victim = i
+			}
+		}
+		old := t.entries[victim]
+		if (t.window <= 0 || at.Sub(old.Time) <= t.window) && latency <= old.latency {
+			return false
+		}
+	}
+
+	r := build()
+	r.Time, r.LatencyMs, r.latency = at, toMillis(latency), latency
+	if victim == len(t.entries) {
+		t.entries = append(t.entries, r)
+	} else {
+		t.entries[victim] = r
+	}
+	return true
+}
+
+// slowest 返回 window 内的记录，按耗时从高到低排列
+func (t *slowTracker) slowest(now time.Time) []SlowRequest {
+	t.mu.Lock()
+	res := make([]SlowRequest, 0, len(t.entries))
+	for _, e := range t.entries {
+		if t.window <= 0 || now.Sub(e.Time) <= t.window {
+			res = append(res, e)
+		}
+	}
+	t.mu.Unlock()
+	slices.SortFunc(res, func(a, b SlowRequest) int { return cmp.Compare(b.latency, a.latency) })
+	return res
+}
+
+// slowestMiddleware 把每个请求交给 slowRequests，供 /api/slow 查看拖慢尾延迟的具体请求
+func slowestMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		slowRequests.observe(start, time.Since(start), func() SlowRequest {
+			requestID, _ := c.Get("RequestID")
+			id, _ := requestID.(string)
+			path := c.Request.URL.Path
+			if raw := c.Request.URL.RawQuery; raw != "" {
+				path += "?" + raw
+			}
+			return SlowRequest{
+				RequestID: id,
+				ClientIP:  getRealIP(c),
+				Method:    c.Request.Method,
+				Path:      path,
+				Route:     c.FullPath(),
+				Status:    c.Writer.Status(),
+			}
+		})
+	}
+}
+
+func slowHandler(c *gin.Context) {
+	entries := slowRequests.slowest(time.Now())
+	if v := c.Query("n"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			abortWithError(c, http.StatusBadRequest, ErrCodeInvalidParam, "n must be a positive integer")
+			return
+		}
+		entries = entries[:min(n, len(entries))]
+	}
+	c.JSON(http.StatusOK, gin.H{"slowest": entries})
+}
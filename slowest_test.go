@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSlowTracker(t *testing.T) {
+	tr := newSlowTracker(3, time.Minute)
+	now := time.Now()
+	add := func(at time.Time, ms int, path string) bool {
+		return tr.observe(at, time.Duration(ms)*time.Millisecond, func() SlowRequest { return SlowRequest{Path: path} })
+	}
+	add(now, 10, "/a")
+	add(now, 30, "/b")
+	add(now, 20, "/c")
+	if add(now, 5, "/fast") {
+		t.Error("faster request should not replace a slower one")
+	}
+	if !add(now, 40, "/d") {
+		t.Error("slower request should replace the fastest")
+	}
+	got := tr.slowest(now)
+	if len(got) != 3 || got[0].Path != "/d" || got[1].Path != "/b" || got[2].Path != "/c" {
+		t.Errorf("slowest = %+v", got)
+	}
+
+	// 过期的记录不再返回，并优先被新请求替换
+	later := now.Add(2 * time.Minute)
+	if !add(later, 1, "/late") {
+		t.Error("request should replace an expired entry")
+	}
+	if got := tr.slowest(later); len(got) != 1 || got[0].Path != "/late" {
+		t.Errorf("after expiry = %+v", got)
+	}
+}
+
+func TestSlowHandler(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	old := slowRequests
+	slowRequests = newSlowTracker(10, time.Hour)
+	defer func() { slowRequests = old }()
+
+	r := gin.New()
+	r.Use(requestIDMiddleware(), slowestMiddleware())
+	r.GET("/sleep", func(c *gin.Context) {
+		time.Sleep(5 * time.Millisecond)
+		c.Status(http.StatusTeapot)
+	})
+	r.GET("/api/slow", slowHandler)
+
+	req, _ := http.NewRequest("GET", "/sleep?x=1", nil)
+	req.Header.Set("X-Request-ID", "slow-1")
+	req.RemoteAddr = "198.51.100.7:1234"
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	w := httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/slow?n=1", nil)
+	r.ServeHTTP(w, req)
+	var body struct {
+		Slowest []SlowRequest `json:"slowest"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if len(body.Slowest) != 1 {
+		t.Fatalf("slowest = %s", w.Body.String())
+	}
+	e := body.Slowest[0]
+	if e.Path != "/sleep?x=1" || e.Route != "/sleep" || e.RequestID != "slow-1" || e.ClientIP != "198.51.100.7" || e.Status != http.StatusTeapot || e.LatencyMs < 5 {
+		t.Errorf("entry = %+v", e)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/slow?n=0", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("n=0 status = %d", w.Code)
+	}
+}
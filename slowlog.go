@@ -0,0 +1,29 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// slowLogger 在请求耗时超过 threshold 时额外输出一行 WARN 日志，与 -access-log 互不影响，
+// 便于在关闭访问日志的情况下仍能定位冷缓存或数据库卡顿导致的慢查询
+func slowLogger(threshold time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		latency := time.Since(start)
+		if latency <= threshold {
+			return
+		}
+		requestID, _ := c.Get("RequestID")
+		path := c.Request.URL.Path
+		if raw := c.Request.URL.RawQuery; raw != "" {
+			path += "?" + raw
+		}
+		log.Printf("WARN: slow request [%s] %s \"%s %s\" %d %s",
+			requestID, getRealIP(c), c.Request.Method, path, c.Writer.Status(), latency.Round(time.Microsecond))
+	}
+}
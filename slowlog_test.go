@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSlowLogger(t *testing.T) {
+	var buf bytes.Buffer
+	orig := log.Writer()
+	log.SetOutput(&buf)
+	defer log.SetOutput(orig)
+
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(requestIDMiddleware(), slowLogger(20*time.Millisecond))
+	r.GET("/fast", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/slow", func(c *gin.Context) {
+		time.Sleep(30 * time.Millisecond)
+		c.Status(http.StatusOK)
+	})
+
+	req, _ := http.NewRequest("GET", "/fast", nil)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	if buf.Len() != 0 {
+		t.Fatalf("fast request logged: %q", buf.String())
+	}
+
+	req, _ = http.NewRequest("GET", "/slow?ip=1.1.1.1", nil)
+	req.RemoteAddr = "192.0.2.7:1234"
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	line := buf.String()
+	for _, want := range []string{"WARN: slow request", "192.0.2.7", `"GET /slow?ip=1.1.1.1"`, " 200 "} {
+		if !strings.Contains(line, want) {
+			t.Errorf("log line %q missing %q", line, want)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import "github.com/oschwald/geoip2-golang/v2"
+
+// DataSource 描述某组字段来自哪个数据库文件及其构建时间，便于审计混合来源的结果
+type DataSource struct {
+	Database   string `json:"database"`
+	Type       string `json:"type,omitempty"`
+	BuildEpoch uint   `json:"build_epoch,omitempty"`
+}
+
+// ResponseSources 按字段组列出数据来源，未返回数据的字段组省略
+type ResponseSources struct {
+	Country *DataSource `json:"country,omitempty"`
+	ASN     *DataSource `json:"asn,omitempty"`
+	ISP     *DataSource `json:"isp,omitempty"`
+}
+
+// includeDBBuild 由 -db-build-date 开启，在响应中返回城市库的构建时间，便于客户端判断数据新旧
+var includeDBBuild bool
+
+// overrideSource 表示字段来自 -overrides 覆盖规则
+var overrideSource = &DataSource{Database: "overrides"}
+
+// newDataSource 记录命中记录的数据库，调用方需持有 dbMutex 读锁
+func newDataSource(path string, r *geoip2.Reader) *DataSource {
+	meta := r.Metadata()
+	return &DataSource{
+		Database:   dbSourceName(path),
+		Type:       meta.DatabaseType,
+		BuildEpoch: meta.BuildEpoch,
+	}
+}
+
+// cityBuildEpoch 返回给出国家数据的数据库的构建时间；来自覆盖规则或没有命中记录时取当前城市库
+func cityBuildEpoch(entry *geoCacheEntry) uint {
+	if src := entry.countrySource; src != nil && src.BuildEpoch > 0 {
+		return src.BuildEpoch
+	}
+	dbMutex.RLock()
+	defer dbMutex.RUnlock()
+	return buildEpoch(countryDB)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/oschwald/geoip2-golang/v2"
+)
+
+func TestResponseSourcesFromOverride(t *testing.T) {
+	list := []override{{prefix: netip.MustParsePrefix("203.0.113.0/24"), countryCode: "JP", asn: 64500, organization: "Example"}}
+	overrides.Store(&list)
+	defer overrides.Store(nil)
+
+	ip := netip.MustParseAddr("203.0.113.9")
+	entry, err := queryGeo(ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := newGeoResponse(ip, entry)
+	if res.Sources == nil || res.Sources.Country != overrideSource || res.Sources.ASN != overrideSource || res.Sources.ISP != nil {
+		t.Errorf("sources = %+v", res.Sources)
+	}
+
+	// 没有任何来源时不返回 sources
+	res = newGeoResponse(ip, &geoCacheEntry{country: entry.country})
+	if res.Sources != nil {
+		t.Errorf("expected no sources, got %+v", res.Sources)
+	}
+}
+
+func TestGeoHandlerDBBuildDate(t *testing.T) {
+	includeDBBuild = true
+	defer func() { includeDBBuild = false }()
+	geoCache = newGeoCache(10)
+	ip := netip.MustParseAddr("192.0.2.10")
+	e := &geoCacheEntry{country: &geoip2.City{}, countrySource: &DataSource{Database: "GeoLite2-City.mmdb", BuildEpoch: 1735689600}}
+	cacheMutex.Lock()
+	cacheAdd(ip.String(), e)
+	cacheMutex.Unlock()
+
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(requestIDMiddleware())
+	r.GET("/api/ipinfo", geoHandler)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/ipinfo?ip=192.0.2.10", nil))
+
+	var res GeoResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.DBBuildEpoch != 1735689600 || res.DBBuildDate != "2025-01-01T00:00:00Z" {
+		t.Errorf("db_build_epoch = %d, db_build_date = %q", res.DBBuildEpoch, res.DBBuildDate)
+	}
+}
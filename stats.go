@@ -0,0 +1,173 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// latencyBounds 为直方图各桶的上界，超过最后一个上界的计入溢出桶
+var latencyBounds = [...]time.Duration{
+	50 * time.Microsecond,
+	100 * time.Microsecond,
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+type latencyHistogram struct {
+	buckets [len(latencyBounds) + 1]atomic.Uint64
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	i := 0
+	for i < len(latencyBounds) && d > latencyBounds[i] {
+		i++
+	}
+	h.buckets[i].Add(1)
+}
+
+// latencyCounts 为直方图各桶计数的快照，两次快照相减即为期间内的分布
+type latencyCounts [len(latencyBounds) + 1]uint64
+
+func (h *latencyHistogram) snapshot() latencyCounts {
+	var counts latencyCounts
+	for i := range h.buckets {
+		counts[i] = h.buckets[i].Load()
+	}
+	return counts
+}
+
+// percentiles 返回各分位数所在桶的上界，溢出桶按最后一个上界计
+func (h *latencyHistogram) percentiles(qs ...float64) []time.Duration {
+	return h.snapshot().percentiles(qs...)
+}
+
+func (counts latencyCounts) total() uint64 {
+	var total uint64
+	for _, n := range counts {
+		total += n
+	}
+	return total
+}
+
+func (counts latencyCounts) sub(prev latencyCounts) latencyCounts {
+	for i := range counts {
+		counts[i] -= prev[i]
+	}
+	return counts
+}
+
+func (counts latencyCounts) percentiles(qs ...float64) []time.Duration {
+	total := counts.total()
+	res := make([]time.Duration, len(qs))
+	if total == 0 {
+		return res
+	}
+	for j, q := range qs {
+		target := max(uint64(math.Ceil(q*float64(total))), 1)
+		var cum uint64
+		for i, n := range counts {
+			cum += n
+			if cum >= target {
+				res[j] = latencyBounds[min(i, len(latencyBounds)-1)]
+				break
+			}
+		}
+	}
+	return res
+}
+
+var (
+	startTime      = time.Now()
+	requestsTotal  atomic.Uint64
+	cacheHits      atomic.Uint64
+	cacheMisses    atomic.Uint64
+	cacheEvictions atomic.Uint64
+	requestLatency latencyHistogram
+	// routeLatency 为按路由模板统计的延迟，路由数量固定，不会随请求路径膨胀
+	routeLatency sync.Map // string → *latencyHistogram
+)
+
+func routeHistogram(path string) *latencyHistogram {
+	if h, ok := routeLatency.Load(path); ok {
+		return h.(*latencyHistogram)
+	}
+	h, _ := routeLatency.LoadOrStore(path, new(latencyHistogram))
+	return h.(*latencyHistogram)
+}
+
+func statsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		elapsed := time.Since(start)
+		requestsTotal.Add(1)
+		requestLatency.observe(elapsed)
+		if path := c.FullPath(); path != "" {
+			routeHistogram(path).observe(elapsed)
+		}
+	}
+}
+
+type StatsResponse struct {
+	UptimeSeconds  int64   `json:"uptime_seconds"`
+	Requests       uint64  `json:"requests"`
+	CacheHits      uint64  `json:"cache_hits"`
+	CacheMisses    uint64  `json:"cache_misses"`
+	CacheHitRatio  float64 `json:"cache_hit_ratio"`
+	LookupTimeouts uint64  `json:"lookup_timeouts"`
+	LatencyP50Ms   float64 `json:"latency_p50_ms"`
+	LatencyP95Ms   float64 `json:"latency_p95_ms"`
+	LatencyP99Ms   float64 `json:"latency_p99_ms"`
+
+	// response_cache_* 仅在启用 -response-cache 时返回
+	ResponseCacheHits     *uint64  `json:"response_cache_hits,omitempty"`
+	ResponseCacheMisses   *uint64  `json:"response_cache_misses,omitempty"`
+	ResponseCacheHitRatio *float64 `json:"response_cache_hit_ratio,omitempty"`
+}
+
+func toMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// statsHandler 返回启动以来的累计统计，延迟分位数精度为直方图桶的上界
+func statsHandler(c *gin.Context) {
+	hits, misses := cacheHits.Load(), cacheMisses.Load()
+	p := requestLatency.percentiles(0.50, 0.95, 0.99)
+
+	res := StatsResponse{
+		UptimeSeconds:  int64(time.Since(startTime).Seconds()),
+		Requests:       requestsTotal.Load(),
+		CacheHits:      hits,
+		CacheMisses:    misses,
+		LookupTimeouts: lookupTimeouts.Load(),
+		LatencyP50Ms:   toMillis(p[0]),
+		LatencyP95Ms:   toMillis(p[1]),
+		LatencyP99Ms:   toMillis(p[2]),
+	}
+	if hits+misses > 0 {
+		res.CacheHitRatio = float64(hits) / float64(hits+misses)
+	}
+	if respCache != nil {
+		hits, misses, ratio := respCache.stats()
+		res.ResponseCacheHits, res.ResponseCacheMisses, res.ResponseCacheHitRatio = &hits, &misses, &ratio
+	}
+	c.JSON(http.StatusOK, res)
+}
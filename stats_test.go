@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyHistogramPercentiles(t *testing.T) {
+	var h latencyHistogram
+	for range 90 {
+		h.observe(80 * time.Microsecond)
+	}
+	for range 9 {
+		h.observe(3 * time.Millisecond)
+	}
+	h.observe(time.Minute)
+
+	p := h.percentiles(0.5, 0.95, 0.999)
+	want := []time.Duration{100 * time.Microsecond, 5 * time.Millisecond, 10 * time.Second}
+	for i := range want {
+		if p[i] != want[i] {
+			t.Errorf("percentile %d: got %v, want %v", i, p[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,61 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFDsStart 为 systemd 传入的第一个 fd（SD_LISTEN_FDS_START）
+const listenFDsStart = 3
+
+// systemdListeners 返回 systemd socket activation 传入的监听 socket，不是由 systemd 激活时返回 nil。
+// names 取自 LISTEN_FDNAMES（socket 单元的 FileDescriptorName=），未设置时为空串。
+// 读取后清除相关环境变量，避免子进程误用
+func systemdListeners() (lns []net.Listener, names []string, err error) {
+	lns, names, err = activationListeners(os.Getenv, os.Getpid(), listenFDsStart)
+	if lns != nil || err != nil {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}
+	return lns, names, err
+}
+
+func activationListeners(getenv func(string) string, pid int, start int) ([]net.Listener, []string, error) {
+	if getenv("LISTEN_PID") != strconv.Itoa(pid) {
+		return nil, nil, nil
+	}
+	n, err := strconv.Atoi(getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil, nil
+	}
+	fdNames := strings.Split(getenv("LISTEN_FDNAMES"), ":")
+
+	var lns []net.Listener
+	var names []string
+	for i := range n {
+		fd := start + i
+		f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		ln, err := net.FileListener(f)
+		// FileListener 复制了 fd，原文件可以关闭
+		f.Close()
+		if err != nil {
+			for _, l := range lns {
+				l.Close()
+			}
+			return nil, nil, fmt.Errorf("systemd socket fd %d: %w", fd, err)
+		}
+		name := ""
+		if i < len(fdNames) {
+			name = fdNames[i]
+		}
+		lns = append(lns, ln)
+		names = append(names, name)
+	}
+	return lns, names, nil
+}
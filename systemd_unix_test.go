@@ -0,0 +1,87 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestActivationListeners(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	// File() 复制出一个新 fd，模拟 systemd 传入的 socket
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	env := map[string]string{"LISTEN_PID": "42", "LISTEN_FDS": "1", "LISTEN_FDNAMES": "https"}
+	getenv := func(k string) string { return env[k] }
+
+	// LISTEN_PID 不是本进程时忽略
+	if lns, _, err := activationListeners(getenv, 7, int(f.Fd())); lns != nil || err != nil {
+		t.Fatalf("other pid: got %v, %v", lns, err)
+	}
+
+	lns, names, err := activationListeners(getenv, 42, int(f.Fd()))
+	if err != nil || len(lns) != 1 {
+		t.Fatalf("activationListeners = %v, %v", lns, err)
+	}
+	defer lns[0].Close()
+	if names[0] != "https" {
+		t.Errorf("name = %q, want https", names[0])
+	}
+	if lns[0].Addr().String() != ln.Addr().String() {
+		t.Errorf("addr = %s, want %s", lns[0].Addr(), ln.Addr())
+	}
+}
+
+func TestServeActivatedListener(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.GET("/", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	// addrs 中的地址不会被监听，已有 listener 优先
+	go func() {
+		done <- serve(ctx, r, serverConfig{addrs: []string{"127.0.0.1:1"}, listeners: []net.Listener{ln}})
+	}()
+
+	url := "http://" + ln.Addr().String() + "/"
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		if resp, err = http.Get(url); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "ok" {
+		t.Errorf("body = %q", body)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("serve = %v", err)
+	}
+}
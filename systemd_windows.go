@@ -0,0 +1,10 @@
+//go:build windows
+
+package main
+
+import "net"
+
+// Windows 没有 systemd，总是自行监听 -port
+func systemdListeners() ([]net.Listener, []string, error) {
+	return nil, nil, nil
+}
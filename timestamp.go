@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+// -timestamp-format 的取值
+const (
+	timestampMillis  = "millis"  // Unix 毫秒，默认，与旧版本兼容
+	timestampUnix    = "unix"    // Unix 秒
+	timestampRFC3339 = "rfc3339" // 2025-08-19T08:35:54.551Z，UTC，精确到毫秒
+)
+
+var timestampFormat = timestampMillis
+
+func validTimestampFormat(f string) bool {
+	return f == timestampMillis || f == timestampUnix || f == timestampRFC3339
+}
+
+// Timestamp 为响应生成时间，内部保存 Unix 毫秒，序列化格式由 -timestamp-format 决定
+type Timestamp int64
+
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	switch timestampFormat {
+	case timestampUnix:
+		return strconv.AppendInt(nil, int64(t)/1000, 10), nil
+	case timestampRFC3339:
+		return strconv.AppendQuote(nil, time.UnixMilli(int64(t)).UTC().Format("2006-01-02T15:04:05.000Z07:00")), nil
+	}
+	return strconv.AppendInt(nil, int64(t), 10), nil
+}
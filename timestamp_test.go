@@ -0,0 +1,25 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTimestampFormat(t *testing.T) {
+	defer func() { timestampFormat = timestampMillis }()
+	res := responseMeta{Timestamp: 1755592554551}
+	for format, want := range map[string]string{
+		timestampMillis:  `{"timestamp":1755592554551}`,
+		timestampUnix:    `{"timestamp":1755592554}`,
+		timestampRFC3339: `{"timestamp":"2025-08-19T08:35:54.551Z"}`,
+	} {
+		timestampFormat = format
+		b, err := json.Marshal(res)
+		if err != nil || string(b) != want {
+			t.Errorf("%s: got %s, %v; want %s", format, b, err, want)
+		}
+	}
+	if validTimestampFormat("iso") {
+		t.Error("iso should be rejected")
+	}
+}
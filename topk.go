@@ -0,0 +1,111 @@
+package main
+
+import (
+	"container/heap"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// topCounter 使用 Space-Saving 算法统计高频 key，最多保留 capacity 个计数器，
+// 大量不同 IP 的扫描也不会让内存无限增长；被挤入的新 key 会继承被淘汰者的计数作为误差上界
+type topCounter struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[string]*topItem
+	heap     topHeap
+}
+
+type topItem struct {
+	key   string
+	count uint64
+	err   uint64
+	index int
+}
+
+// topHeap 为按 count 排序的最小堆
+type topHeap []*topItem
+
+func (h topHeap) Len() int           { return len(h) }
+func (h topHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h topHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *topHeap) Push(x any) {
+	item := x.(*topItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+func (h *topHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+func newTopCounter(capacity int) *topCounter {
+	return &topCounter{capacity: capacity, items: make(map[string]*topItem, capacity)}
+}
+
+func (t *topCounter) add(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if item, ok := t.items[key]; ok {
+		item.count++
+		heap.Fix(&t.heap, item.index)
+		return
+	}
+	if len(t.heap) < t.capacity {
+		item := &topItem{key: key, count: 1}
+		t.items[key] = item
+		heap.Push(&t.heap, item)
+		return
+	}
+
+	// 替换计数最小的条目
+	min := t.heap[0]
+	delete(t.items, min.key)
+	min.key = key
+	min.err = min.count
+	min.count++
+	t.items[key] = min
+	heap.Fix(&t.heap, 0)
+}
+
+type TopEntry struct {
+	IP    string `json:"ip"`
+	Count uint64 `json:"count"`
+	Error uint64 `json:"error,omitempty"` // 计数可能高估的上限
+}
+
+func (t *topCounter) top(n int) []TopEntry {
+	t.mu.Lock()
+	entries := make([]TopEntry, 0, len(t.heap))
+	for _, item := range t.heap {
+		entries = append(entries, TopEntry{IP: item.key, Count: item.count, Error: item.err})
+	}
+	t.mu.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Count > entries[j].Count })
+	if n < len(entries) {
+		entries = entries[:n]
+	}
+	return entries
+}
+
+var topIPs = newTopCounter(1000)
+
+func topHandler(c *gin.Context) {
+	n, err := strconv.Atoi(c.DefaultQuery("n", "50"))
+	if err != nil || n < 1 {
+		abortWithError(c, http.StatusBadRequest, ErrCodeInvalidParam, "n must be a positive integer")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"top": topIPs.top(n)})
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTopCounter(t *testing.T) {
+	tc := newTopCounter(10)
+	for range 10 {
+		tc.add("8.8.8.8")
+	}
+	for range 5 {
+		tc.add("1.1.1.1")
+	}
+	// 大量只出现一次的 IP 不应挤掉热点，也不能让计数器数量超过容量
+	for i := range 20 {
+		tc.add(fmt.Sprintf("10.0.0.%d", i))
+	}
+
+	top := tc.top(100)
+	if len(top) != 10 {
+		t.Fatalf("expected 10 entries, got %d", len(top))
+	}
+	if top[0].IP != "8.8.8.8" || top[0].Count != 10 {
+		t.Errorf("top[0] = %+v", top[0])
+	}
+	if top[1].IP != "1.1.1.1" || top[1].Count != 5 {
+		t.Errorf("top[1] = %+v", top[1])
+	}
+	if got := tc.top(1); len(got) != 1 {
+		t.Errorf("top(1) returned %d entries", len(got))
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "geoip-server"
+
+var (
+	// tracingEnabled 为 false 时不创建任何 span，中间件与查询都走原有路径
+	tracingEnabled bool
+	tracer         = otel.Tracer(tracerName)
+)
+
+// otlpConfigured 按 OpenTelemetry 标准环境变量判断是否配置了 OTLP 导出
+func otlpConfigured(getenv func(string) string) bool {
+	if strings.EqualFold(getenv("OTEL_SDK_DISABLED"), "true") {
+		return false
+	}
+	if exp := getenv("OTEL_TRACES_EXPORTER"); exp != "" && exp != "otlp" {
+		return false
+	}
+	return getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// setupTracing 在配置了 OTLP 端点时安装 SDK（端点、头部、采样等均由 OTEL_ 环境变量决定），
+// 未配置时什么也不做，返回的 shutdown 用于退出前把缓冲的 span 发送出去
+func setupTracing(ctx context.Context) (func(context.Context) error, error) {
+	if !otlpConfigured(os.Getenv) {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("create OTLP exporter: %w", err)
+	}
+	// 默认服务名在前，OTEL_SERVICE_NAME / OTEL_RESOURCE_ATTRIBUTES 可覆盖
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(tracerName), semconv.ServiceVersion(Version)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("build tracing resource: %w", err)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	installTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+func installTracerProvider(tp trace.TracerProvider) {
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	tracer = tp.Tracer(tracerName)
+	tracingEnabled = true
+}
+
+// tracingMiddleware 为每个请求创建 server span，父 span 取自请求头中的 traceparent
+func tracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !tracingEnabled {
+			c.Next()
+			return
+		}
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		route := c.FullPath()
+		name := c.Request.Method
+		if route != "" {
+			name += " " + route
+		}
+		ctx, span := tracer.Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Request.Method),
+				semconv.URLPath(c.Request.URL.Path),
+				semconv.ClientAddress(c.ClientIP()),
+			),
+		)
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if route != "" {
+			span.SetAttributes(semconv.HTTPRoute(route))
+		}
+		if id, ok := c.Get("RequestID"); ok {
+			span.SetAttributes(attribute.String("http.request.id", id.(string)))
+		}
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
+
+// tracedQueryGeo 在请求 span 下为 queryGeoWith 创建子 span，记录是否命中缓存与数据来源
+func tracedQueryGeo(ctx context.Context, ip netip.Addr, opts lookupOptions) (*geoCacheEntry, error) {
+	if !tracingEnabled {
+		return queryGeoWith(ip, opts)
+	}
+	_, span := tracer.Start(ctx, "queryGeo", trace.WithAttributes(attribute.Bool("geoip.skip_asn", opts.skipASN)))
+	defer span.End()
+
+	var hit bool
+	opts.cacheHit = &hit
+	entry, err := queryGeoWith(ip, opts)
+	span.SetAttributes(attribute.Bool("geoip.cache_hit", hit))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return entry, err
+	}
+	if entry.countrySource != nil {
+		span.SetAttributes(attribute.String("geoip.country_source", entry.countrySource.Database))
+	}
+	if entry.asnSource != nil {
+		span.SetAttributes(attribute.String("geoip.asn_source", entry.asnSource.Database))
+	}
+	return entry, nil
+}
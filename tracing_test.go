@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestOTLPConfigured(t *testing.T) {
+	for _, tc := range []struct {
+		env  map[string]string
+		want bool
+	}{
+		{map[string]string{}, false},
+		{map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318"}, true},
+		{map[string]string{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "http://collector:4318/v1/traces"}, true},
+		{map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318", "OTEL_SDK_DISABLED": "true"}, false},
+		{map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318", "OTEL_TRACES_EXPORTER": "none"}, false},
+	} {
+		if got := otlpConfigured(func(k string) string { return tc.env[k] }); got != tc.want {
+			t.Errorf("otlpConfigured(%v) = %v, want %v", tc.env, got, tc.want)
+		}
+	}
+}
+
+func TestTracingSpans(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	installTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	defer func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		tracer = otel.Tracer(tracerName)
+		tracingEnabled = false
+	}()
+
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(tracingMiddleware(), requestIDMiddleware())
+	r.GET("/api/ipinfo", geoHandler)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/ipinfo?ip=127.0.0.1", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+
+	spans := rec.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	lookup, server := spans[0], spans[1]
+	if server.Name() != "GET /api/ipinfo" {
+		t.Errorf("server span name = %q", server.Name())
+	}
+	if got := server.SpanContext().TraceID().String(); got != traceID {
+		t.Errorf("trace ID = %s, want %s from traceparent", got, traceID)
+	}
+	if !server.Parent().IsRemote() {
+		t.Error("server span parent should be the remote traceparent span")
+	}
+	if lookup.Name() != "queryGeo" || lookup.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Errorf("lookup span %q is not a child of the server span", lookup.Name())
+	}
+	if !hasAttr(lookup.Attributes(), "geoip.cache_hit") {
+		t.Error("lookup span missing geoip.cache_hit")
+	}
+	if !hasAttr(server.Attributes(), "http.request.id") {
+		t.Error("server span missing http.request.id")
+	}
+}
+
+func hasAttr(attrs []attribute.KeyValue, key attribute.Key) bool {
+	for _, kv := range attrs {
+		if kv.Key == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed web/index.html
+var indexHTML []byte
+
+func uiHandler(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", indexHTML)
+}
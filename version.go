@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+
+	"github.com/gin-gonic/gin"
+)
+
+type VersionResponse struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+func versionInfo() VersionResponse {
+	return VersionResponse{
+		Version:   Version,
+		Commit:    CurrentCommit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+}
+
+func versionHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, versionInfo())
+}
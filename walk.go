@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/netip"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type walkRow struct {
+	Network      string `json:"network"`
+	CountryCode  string `json:"country_code,omitempty"`
+	ASN          uint   `json:"asn,omitempty"`
+	Organization string `json:"organization,omitempty"`
+}
+
+type walkRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	ASN          uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// walkAfter 判断遍历到的网段是否位于游标 start 之后。
+// 不遍历 IPv4 别名时 Networks() 先输出 IPv4 再输出 IPv6、各自按地址递增，与 netip.Addr.Compare 的顺序一致
+func walkAfter(p, start netip.Prefix) bool {
+	if p == start {
+		return false
+	}
+	return p.Addr().Compare(start.Addr()) >= 0
+}
+
+// walkHandler 按 Networks() 的顺序流式输出整个库的网段（JSONL）。
+// start 为上一页最后一行的 network，从其之后继续；limit 限制本次输出的行数，0 为不限制
+func walkHandler(c *gin.Context) {
+	db := c.DefaultQuery("db", "country")
+	var path string
+	switch db {
+	case "country":
+		path = countryDBPath
+	case "asn":
+		path = asnDBPath
+	default:
+		abortWithError(c, http.StatusBadRequest, ErrCodeInvalidParam, "db must be country or asn")
+		return
+	}
+
+	var start netip.Prefix
+	if s := c.Query("start"); s != "" {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, ErrCodeInvalidParam, "start must be a CIDR prefix such as 1.0.0.0/24")
+			return
+		}
+		start = p.Masked()
+	}
+	limit := 0
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			abortWithError(c, http.StatusBadRequest, ErrCodeInvalidParam, "limit must be a non-negative integer")
+			return
+		}
+		limit = n
+	}
+
+	dbMutex.RLock()
+	loaded := (db == "country" && countryDB != nil) || (db == "asn" && asnDB != nil)
+	dbMutex.RUnlock()
+	if !loaded {
+		abortWithError(c, http.StatusServiceUnavailable, ErrCodeNoData, "Database not loaded")
+		return
+	}
+
+	// 与导出共用并发限制，二者都需要遍历整个库
+	select {
+	case exportSlots <- struct{}{}:
+		defer func() { <-exportSlots }()
+	default:
+		abortWithError(c, http.StatusTooManyRequests, ErrCodeRateLimited, "Another export is in progress")
+		return
+	}
+
+	reader, err := openRawMMDB(path)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, ErrCodeLookupFailed, "Failed to open database")
+		return
+	}
+	defer reader.Close()
+
+	clearWriteDeadline(c)
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	enc := json.NewEncoder(c.Writer)
+
+	ctx := c.Request.Context()
+	rows := 0
+	for result := range reader.Networks() {
+		prefix := result.Prefix()
+		if start.IsValid() && !walkAfter(prefix, start) {
+			continue
+		}
+		var record walkRecord
+		if err := result.Decode(&record); err != nil {
+			requestID, _ := c.Get("RequestID")
+			log.Printf("[%s] Walk aborted: %v", requestID, err)
+			break
+		}
+		row := walkRow{Network: prefix.String()}
+		if db == "country" {
+			row.CountryCode = record.Country.ISOCode
+		} else {
+			row.ASN, row.Organization = record.ASN, record.Organization
+		}
+		if err := enc.Encode(row); err != nil {
+			break
+		}
+		rows++
+		if limit > 0 && rows >= limit {
+			break
+		}
+		if rows%exportFlushEvery == 0 {
+			c.Writer.Flush()
+			if ctx.Err() != nil {
+				// 客户端已断开
+				return
+			}
+		}
+	}
+	c.Writer.Flush()
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestWalkAfter(t *testing.T) {
+	start := netip.MustParsePrefix("1.0.0.0/24")
+	for s, want := range map[string]bool{
+		"1.0.0.0/24":    false,
+		"0.255.0.0/16":  false,
+		"1.0.1.0/24":    true,
+		"2001:db8::/32": true,
+	} {
+		if got := walkAfter(netip.MustParsePrefix(s), start); got != want {
+			t.Errorf("walkAfter(%s) = %v, want %v", s, got, want)
+		}
+	}
+	if walkAfter(netip.MustParsePrefix("1.0.0.0/8"), netip.MustParsePrefix("2001:db8::/32")) {
+		t.Error("IPv4 networks should come before an IPv6 cursor")
+	}
+}
+
+func TestWalkHandler(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(requestIDMiddleware())
+	r.GET("/api/walk", walkHandler)
+
+	walk := func(query string) (int, []walkRow) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/walk?"+query, nil)
+		r.ServeHTTP(w, req)
+		var rows []walkRow
+		if w.Code != http.StatusOK {
+			return w.Code, nil
+		}
+		dec := json.NewDecoder(w.Body)
+		for dec.More() {
+			var row walkRow
+			if err := dec.Decode(&row); err != nil {
+				t.Fatalf("%s: %v", query, err)
+			}
+			rows = append(rows, row)
+		}
+		return w.Code, rows
+	}
+
+	if code, _ := walk("db=asn"); code != http.StatusServiceUnavailable {
+		t.Errorf("without database: status = %d, want 503", code)
+	}
+
+	path := writeTestMMDB(t, "GeoLite2-ASN", map[string]any{
+		"1.1.1.0/24": map[string]any{"autonomous_system_number": uint32(13335), "autonomous_system_organization": "CLOUDFLARENET"},
+		"8.8.4.0/24": map[string]any{"autonomous_system_number": uint32(15169), "autonomous_system_organization": "GOOGLE"},
+		"8.8.8.0/24": map[string]any{"autonomous_system_number": uint32(15169), "autonomous_system_organization": "GOOGLE"},
+		"9.9.9.0/24": map[string]any{"autonomous_system_number": uint32(19281), "autonomous_system_organization": "QUAD9-AS-1"},
+	})
+	db, err := openMMDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	asnDB, asnDBPath = db, path
+	defer func() { asnDB, asnDBPath = nil, "" }()
+
+	// 逐页遍历：每页以上一页最后一行的 network 作为 start，拼起来与一次遍历完整个库相同
+	_, all := walk("db=asn")
+	if len(all) != 4 || all[0] != (walkRow{Network: "1.1.1.0/24", ASN: 13335, Organization: "CLOUDFLARENET"}) {
+		t.Fatalf("full walk = %+v", all)
+	}
+	var paged []walkRow
+	for query := "db=asn&limit=3"; ; {
+		code, rows := walk(query)
+		if code != http.StatusOK {
+			t.Fatalf("%s: status = %d", query, code)
+		}
+		if len(rows) == 0 {
+			break
+		}
+		paged = append(paged, rows...)
+		query = "db=asn&limit=3&start=" + rows[len(rows)-1].Network
+	}
+	if !reflect.DeepEqual(paged, all) {
+		t.Errorf("paged walk = %+v, want %+v", paged, all)
+	}
+
+	for _, query := range []string{"db=isp", "db=asn&start=bogus", "db=asn&limit=-1"} {
+		if code, _ := walk(query); code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, code)
+		}
+	}
+
+	exportSlots <- struct{}{}
+	code, _ := walk("db=asn")
+	<-exportSlots
+	if code != http.StatusTooManyRequests {
+		t.Errorf("walk during an export: status = %d, want 429", code)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// warmCache 读取每行一个 IP 的文件并逐个查询，在开始服务前预热缓存。
+// 单个 IP 失败只记录日志，不影响启动
+func warmCache(path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Printf("Failed to open warm file: %v", err)
+		return
+	}
+	defer f.Close()
+
+	start := time.Now()
+	warmed, failed := 0, 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ip, err := parseLookupIP(line)
+		if err != nil {
+			log.Printf("Warm: skipping invalid IP %q", line)
+			failed++
+			continue
+		}
+		if _, err := queryGeo(ip); err != nil {
+			log.Printf("Warm: lookup failed for %s: %v", ip, err)
+			failed++
+			continue
+		}
+		warmed++
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("Warm: failed to read %s: %v", path, err)
+	}
+	log.Printf("Warmed cache with %d IPs in %s (%d failed)", warmed, time.Since(start), failed)
+}
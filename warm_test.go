@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWarmCache(t *testing.T) {
+	orig := geoCache
+	geoCache = newGeoCache(10)
+	defer func() { geoCache = orig }()
+
+	path := filepath.Join(t.TempDir(), "warm.txt")
+	content := "# 常见客户端\n\n203.0.113.1\n  198.51.100.2  \nnot-an-ip\nfe80::1%eth0\n# 203.0.113.99\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	warmCache(path)
+
+	for _, s := range []string{"203.0.113.1", "198.51.100.2"} {
+		if _, ok := cacheGet(netip.MustParseAddr(s)); !ok {
+			t.Errorf("%s was not warmed", s)
+		}
+	}
+	// 注释、空行与无效行都被跳过
+	if geoCache.Len() != 2 {
+		t.Errorf("cache has %d entries, want 2", geoCache.Len())
+	}
+
+	// 文件不存在时只记录日志
+	warmCache(filepath.Join(t.TempDir(), "missing.txt"))
+}